@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/maintenance"
+	"github.com/sirupsen/logrus"
+)
+
+// erase permanently deletes accounts whose archive grace period has run out.
+// It is run by an operator, e.g. `go run ./cmd/erase -dry-run`.
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, so the deferred database shutdown always runs.
+func run() int {
+	dryRun := flag.Bool("dry-run", false, "only report how many accounts would be erased")
+	flag.Parse()
+
+	config.Init()
+	if err := database.ConnectAndMigrate(); err != nil {
+		logrus.WithError(err).Error("failed to initialize the database")
+		return 1
+	}
+	defer database.ShutdownDatabase()
+
+	ctx := context.Background()
+	archivedBefore := time.Now().Add(-config.AccountDeletionGracePeriod)
+
+	if *dryRun {
+		count, err := maintenance.CountErasableUsers(ctx, archivedBefore)
+		if err != nil {
+			logrus.WithError(err).Error("failed to count erasable users")
+			return 1
+		}
+		logrus.Infof("%d archived accounts would be erased", count)
+		return 0
+	}
+
+	erased, err := maintenance.EraseArchivedUsers(ctx, archivedBefore, config.MaintenanceBatchSize)
+	if err != nil {
+		logrus.WithError(err).Errorf("erasure stopped after %d accounts", erased)
+		return 1
+	}
+	logrus.Infof("erased %d archived accounts", erased)
+	return 0
+}
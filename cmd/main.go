@@ -11,6 +11,11 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/jwtkeys"
+	"github.com/ray-remotestate/todoEx/mailer"
+	"github.com/ray-remotestate/todoEx/maintenance"
+	"github.com/ray-remotestate/todoEx/oidc"
+	"github.com/ray-remotestate/todoEx/passwordpolicy"
 	"github.com/ray-remotestate/todoEx/server"
 	"github.com/ray-remotestate/todoEx/config"
 )
@@ -19,6 +24,10 @@ const shutDownTimeOut = 10 * time.Second
 
 func main() {
 	config.Init()
+	jwtkeys.Init()
+	mailer.Init()
+	oidc.Init()
+	passwordpolicy.Init()
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -29,6 +38,8 @@ func main() {
 	}
 	logrus.Println("Migration is successful")
 
+	reaper := maintenance.Start(config.MaintenanceInterval, config.MaintenanceBatchSize)
+
 	go func() {
 		log.Println("Server starting at :8080")
 		if err := svr.Run(":8080"); err != nil {
@@ -39,6 +50,7 @@ func main() {
 	<-done
 
 	logrus.Info("Shutting down server...")
+	reaper.Stop()
 	if err := database.ShutdownDatabase(); err != nil {
 		logrus.WithError(err).Error("Failed to close database connection")
 	}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/sirupsen/logrus"
+)
+
+// role grants or takes away a role, which is how the first admin is created,
+// e.g. `go run ./cmd/role -email jane@example.com -role admin`.
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, so the deferred database shutdown always runs.
+func run() int {
+	email := flag.String("email", "", "email of the account to change")
+	role := flag.String("role", middlewares.RoleAdmin, "role to assign (user or admin)")
+	flag.Parse()
+
+	if *email == "" || (*role != middlewares.RoleUser && *role != middlewares.RoleAdmin) {
+		flag.Usage()
+		return 2
+	}
+
+	config.Init()
+	if err := database.ConnectAndMigrate(); err != nil {
+		logrus.WithError(err).Error("failed to initialize the database")
+		return 1
+	}
+	defer database.ShutdownDatabase()
+
+	found, err := dbHelper.SetUserRoleByEmail(*email, *role)
+	if err != nil {
+		logrus.WithError(err).Error("failed to set role")
+		return 1
+	}
+	if !found {
+		logrus.Errorf("no active account with email %s", *email)
+		return 1
+	}
+	logrus.Infof("%s is now %s", *email, *role)
+	return 0
+}
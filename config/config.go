@@ -2,12 +2,96 @@ package config
 
 import (
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
-var SecretKey []byte
+var (
+	SecretKey            []byte
+	JWTIssuer            string
+	JWTAudience          string
+	JWTLifetime          time.Duration
+	RefreshTokenLifetime time.Duration
+
+	JWTSigningKeyFile       string
+	JWTVerificationKeyFiles []string
+	JWTAcceptHS256          bool
+
+	RevocationSyncInterval time.Duration
+
+	TrustProxyHeaders bool
+	TrustedProxyHops  int
+
+	Argon2Memory      uint32
+	Argon2Time        uint32
+	Argon2Parallelism uint8
+
+	PasswordMinLength        int
+	PasswordMaxLength        int
+	PasswordMinEntropyBits   int
+	PasswordBreachedListPath string
+
+	SessionLifetime      time.Duration
+	SessionIdleTimeout   time.Duration
+	SessionTouchInterval time.Duration
+
+	SessionCookieName     string
+	CSRFCookieName        string
+	SessionCookieDomain   string
+	SessionCookieSecure   bool
+	SessionCookieSameSite http.SameSite
+
+	MaintenanceInterval  time.Duration
+	MaintenanceBatchSize int
+
+	AppBaseURL                 string
+	PasswordResetURL           string
+	PasswordResetTokenLifetime time.Duration
+
+	EmailVerificationTokenLifetime time.Duration
+	RequireVerifiedEmail           bool
+
+	AccountDeletionGracePeriod time.Duration
+
+	PersonalAccessTokenMaxLifetime time.Duration
+
+	TOTPIssuer           string
+	MFAChallengeLifetime time.Duration
+	MFAMaxAttempts       int
+
+	LoginMaxFailuresPerAccount int
+	LoginMaxFailuresPerIP      int
+	LoginFailureWindow         time.Duration
+	LoginLockoutBase           time.Duration
+	LoginLockoutMax            time.Duration
+
+	RateLimitEnabled         bool
+	RateLimitBackend         string
+	RateLimitPublicPerMinute int
+	RateLimitPublicBurst     int
+	RateLimitAPIPerMinute    int
+	RateLimitAPIBurst        int
+
+	OIDCIssuerURL          string
+	OIDCClientID           string
+	OIDCClientSecret       string
+	OIDCRedirectURL        string
+	OIDCScopes             []string
+	OIDCProviderName       string
+	OIDCLoginStateLifetime time.Duration
+
+	MailDriver   string
+	MailFrom     string
+	MailFilePath string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+)
 
 func Init() {
 	err := godotenv.Load()
@@ -21,4 +105,164 @@ func Init() {
 	}
 
 	SecretKey = []byte(secret)
+	JWTIssuer = getEnv("JWT_ISSUER", "todoEx")
+	JWTAudience = getEnv("JWT_AUDIENCE", "todoEx")
+	JWTLifetime = getDuration("JWT_LIFETIME", 15*time.Minute)
+	RefreshTokenLifetime = getDuration("REFRESH_TOKEN_LIFETIME", 30*24*time.Hour)
+
+	JWTSigningKeyFile = os.Getenv("JWT_SIGNING_KEY_FILE")
+	JWTVerificationKeyFiles = strings.FieldsFunc(os.Getenv("JWT_VERIFICATION_KEY_FILES"), func(r rune) bool { return r == ',' })
+	JWTAcceptHS256 = getBool("JWT_ACCEPT_HS256", false)
+
+	RevocationSyncInterval = getDuration("REVOCATION_SYNC_INTERVAL", 30*time.Second)
+
+	TrustProxyHeaders = getBool("TRUST_PROXY_HEADERS", false)
+	TrustedProxyHops = getInt("TRUSTED_PROXY_HOPS", 1)
+	if TrustedProxyHops < 1 {
+		log.Fatal("TRUSTED_PROXY_HOPS must be at least 1")
+	}
+
+	// memory is in KiB; the defaults follow the OWASP recommendation
+	memory := getInt("ARGON2_MEMORY", 64*1024)
+	iterations := getInt("ARGON2_TIME", 3)
+	parallelism := getInt("ARGON2_PARALLELISM", 2)
+	if parallelism < 1 || parallelism > 255 || iterations < 1 || memory < 8*parallelism || memory > 4*1024*1024 {
+		log.Fatal("invalid ARGON2_* parameters")
+	}
+	Argon2Memory = uint32(memory)
+	Argon2Time = uint32(iterations)
+	Argon2Parallelism = uint8(parallelism)
+
+	PasswordMinLength = getInt("PASSWORD_MIN_LENGTH", 8)
+	PasswordMaxLength = getInt("PASSWORD_MAX_LENGTH", 128)
+	PasswordMinEntropyBits = getInt("PASSWORD_MIN_ENTROPY_BITS", 35)
+	PasswordBreachedListPath = os.Getenv("PASSWORD_BREACHED_LIST_PATH")
+
+	SessionLifetime = getDuration("SESSION_LIFETIME", 120*time.Hour)
+	SessionIdleTimeout = getDuration("SESSION_IDLE_TIMEOUT", 24*time.Hour)
+	SessionTouchInterval = getDuration("SESSION_TOUCH_INTERVAL", time.Minute)
+
+	SessionCookieName = getEnv("SESSION_COOKIE_NAME", "todoex_session")
+	CSRFCookieName = getEnv("CSRF_COOKIE_NAME", "todoex_csrf")
+	SessionCookieDomain = os.Getenv("SESSION_COOKIE_DOMAIN")
+	SessionCookieSecure = getBool("SESSION_COOKIE_SECURE", true)
+	switch sameSite := getEnv("SESSION_COOKIE_SAMESITE", "lax"); sameSite {
+	case "lax":
+		SessionCookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		SessionCookieSameSite = http.SameSiteStrictMode
+	case "none":
+		if !SessionCookieSecure {
+			log.Fatal("SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE")
+		}
+		SessionCookieSameSite = http.SameSiteNoneMode
+	default:
+		log.Fatalf("invalid SESSION_COOKIE_SAMESITE %q", sameSite)
+	}
+
+	MaintenanceInterval = getDuration("MAINTENANCE_INTERVAL", 10*time.Minute)
+	MaintenanceBatchSize = getInt("MAINTENANCE_BATCH_SIZE", 500)
+	if MaintenanceInterval <= 0 || MaintenanceBatchSize <= 0 {
+		log.Fatal("MAINTENANCE_INTERVAL and MAINTENANCE_BATCH_SIZE must be positive")
+	}
+
+	AppBaseURL = getEnv("APP_BASE_URL", "http://localhost:8080")
+	// point this at the front end's reset page; the default is the API's own form
+	PasswordResetURL = getEnv("PASSWORD_RESET_URL", AppBaseURL+"/password/reset")
+	PasswordResetTokenLifetime = getDuration("PASSWORD_RESET_TOKEN_LIFETIME", time.Hour)
+
+	EmailVerificationTokenLifetime = getDuration("EMAIL_VERIFICATION_TOKEN_LIFETIME", 48*time.Hour)
+	RequireVerifiedEmail = getBool("REQUIRE_VERIFIED_EMAIL", false)
+
+	AccountDeletionGracePeriod = getDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+
+	// also the lifetime of tokens created without expires_at
+	PersonalAccessTokenMaxLifetime = getDuration("PERSONAL_ACCESS_TOKEN_MAX_LIFETIME", 365*24*time.Hour)
+	if PersonalAccessTokenMaxLifetime <= 0 {
+		log.Fatal("PERSONAL_ACCESS_TOKEN_MAX_LIFETIME must be positive")
+	}
+
+	TOTPIssuer = getEnv("TOTP_ISSUER", "todoEx")
+	MFAChallengeLifetime = getDuration("MFA_CHALLENGE_LIFETIME", 5*time.Minute)
+	MFAMaxAttempts = getInt("MFA_MAX_ATTEMPTS", 5)
+
+	LoginMaxFailuresPerAccount = getInt("LOGIN_MAX_FAILURES_PER_ACCOUNT", 5)
+	LoginMaxFailuresPerIP = getInt("LOGIN_MAX_FAILURES_PER_IP", 20)
+	LoginFailureWindow = getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	LoginLockoutBase = getDuration("LOGIN_LOCKOUT_BASE", time.Minute)
+	LoginLockoutMax = getDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+
+	RateLimitEnabled = getBool("RATE_LIMIT_ENABLED", true)
+	RateLimitBackend = getEnv("RATE_LIMIT_BACKEND", "memory")
+	RateLimitPublicPerMinute = getInt("RATE_LIMIT_PUBLIC_PER_MINUTE", 20)
+	RateLimitPublicBurst = getInt("RATE_LIMIT_PUBLIC_BURST", 10)
+	RateLimitAPIPerMinute = getInt("RATE_LIMIT_API_PER_MINUTE", 300)
+	RateLimitAPIBurst = getInt("RATE_LIMIT_API_BURST", 60)
+	if RateLimitBackend != "memory" && RateLimitBackend != "postgres" {
+		log.Fatalf("invalid RATE_LIMIT_BACKEND %q", RateLimitBackend)
+	}
+	if RateLimitPublicPerMinute <= 0 || RateLimitPublicBurst <= 0 || RateLimitAPIPerMinute <= 0 || RateLimitAPIBurst <= 0 {
+		log.Fatal("RATE_LIMIT_*_PER_MINUTE and RATE_LIMIT_*_BURST must be positive")
+	}
+
+	OIDCIssuerURL = os.Getenv("OIDC_ISSUER_URL")
+	OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
+	OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", AppBaseURL+"/oidc/callback")
+	OIDCScopes = strings.Fields(getEnv("OIDC_SCOPES", "openid email profile"))
+	OIDCProviderName = getEnv("OIDC_PROVIDER_NAME", "oidc")
+	OIDCLoginStateLifetime = getDuration("OIDC_LOGIN_STATE_LIFETIME", 10*time.Minute)
+	if OIDCIssuerURL != "" && OIDCClientID == "" {
+		log.Fatal("OIDC_CLIENT_ID must be set when OIDC_ISSUER_URL is")
+	}
+
+	MailDriver = getEnv("MAIL_DRIVER", "log")
+	MailFrom = getEnv("MAIL_FROM", "no-reply@todoex.local")
+	MailFilePath = getEnv("MAIL_FILE_PATH", "mail.log")
+	SMTPAddr = getEnv("SMTP_ADDR", "localhost:1025")
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid duration for %s: %v", key, err)
+	}
+	return d
+}
+
+func getBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid boolean for %s: %v", key, err)
+	}
+	return b
+}
+
+func getInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid integer for %s: %v", key, err)
+	}
+	return i
 }
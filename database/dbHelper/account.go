@@ -0,0 +1,66 @@
+package dbHelper
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+)
+
+func UpdateUserProfile(userID uuid.UUID, name, timezone string, preferences json.RawMessage) error {
+	_, err := database.TodoEx.Exec(`
+		UPDATE users
+		SET name = $1, timezone = $2, preferences = $3
+		WHERE id = $4 AND archived_at IS NULL`, name, timezone, []byte(preferences), userID)
+	return err
+}
+
+// ArchiveUser soft-deletes the account together with its live todos, stamping
+// both with the same archivedAt so RestoreUser can tell which todos to bring
+// back. All credentials are revoked. Call it inside database.Tx.
+func ArchiveUser(exec SQLExecutor, userID uuid.UUID, archivedAt time.Time) error {
+	archivedAt = archivedAt.UTC()
+	if _, err := exec.Exec(`UPDATE users SET archived_at = $1 WHERE id = $2 AND archived_at IS NULL`, archivedAt, userID); err != nil {
+		return err
+	}
+	if _, err := exec.Exec(`UPDATE todo SET archived_at = $1 WHERE user_id = $2 AND archived_at IS NULL`, archivedAt, userID); err != nil {
+		return err
+	}
+	return RevokeAllUserTokens(exec, userID)
+}
+
+// RestoreUser reverses ArchiveUser. It fails with a unique violation when a
+// new account has taken the email address in the meantime.
+func RestoreUser(exec SQLExecutor, userID uuid.UUID, archivedAt time.Time) error {
+	archivedAt = archivedAt.UTC()
+	if _, err := exec.Exec(`UPDATE users SET archived_at = NULL WHERE id = $1 AND archived_at = $2`, userID, archivedAt); err != nil {
+		return err
+	}
+	_, err := exec.Exec(`UPDATE todo SET archived_at = NULL WHERE user_id = $1 AND archived_at = $2`, userID, archivedAt)
+	return err
+}
+
+// GetArchivedUserIDByPassword finds the most recently archived account for the
+// email that is still inside the grace period and checks its password.
+func GetArchivedUserIDByPassword(email, password string, archivedSince time.Time) (uuid.UUID, time.Time, error) {
+	var id uuid.UUID
+	var hashedPassword string
+	var archivedAt time.Time
+
+	err := database.TodoEx.QueryRow(`
+		SELECT id, password, archived_at FROM users
+		WHERE LOWER(email) = LOWER($1) AND archived_at > $2
+		ORDER BY archived_at DESC
+		LIMIT 1`, email, archivedSince).
+		Scan(&id, &hashedPassword, &archivedAt)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+
+	if _, err := checkPassword(hashedPassword, password); err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+
+	return id, archivedAt, nil
+}
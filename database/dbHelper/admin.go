@@ -0,0 +1,73 @@
+package dbHelper
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+const (
+	UserStatusActive   = "active"
+	UserStatusArchived = "archived"
+	UserStatusAll      = "all"
+)
+
+// ListUsers pages through accounts newest first. search matches a substring of
+// the name or email, case-insensitively.
+func ListUsers(search, status string, limit, offset int) ([]models.User, error) {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, name, email, role, created_at, archived_at, email_verified_at, timezone, preferences
+		FROM users
+		WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		  AND ($2 = 'all' OR ($2 = 'active') = (archived_at IS NULL))
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4`, escapeLike(search), status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt, &user.ArchivedAt, &user.EmailVerifiedAt,
+			&user.Timezone, &user.Preferences); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetAnyUserByID is GetUserByUserID without the archived_at filter, for
+// support staff who need to see deleted accounts too.
+func GetAnyUserByID(userID uuid.UUID) (models.User, error) {
+	var user models.User
+	err := database.TodoEx.QueryRow(`
+		SELECT id, name, email, role, created_at, archived_at, email_verified_at, timezone, preferences
+		FROM users
+		WHERE id = $1`, userID).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt, &user.ArchivedAt, &user.EmailVerifiedAt,
+			&user.Timezone, &user.Preferences)
+	return user, err
+}
+
+// SetUserRoleByEmail changes the role of the live account with that email and
+// reports whether one was found.
+func SetUserRoleByEmail(email, role string) (bool, error) {
+	result, err := database.TodoEx.Exec(`
+		UPDATE users SET role = $1
+		WHERE LOWER(email) = LOWER($2) AND archived_at IS NULL`, role, email)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
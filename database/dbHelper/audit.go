@@ -0,0 +1,59 @@
+package dbHelper
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+// RecordAuditEvent stores a security-relevant event. userID may be uuid.Nil
+// for events that cannot be tied to an account, such as a failed login for an
+// unknown email.
+func RecordAuditEvent(exec SQLExecutor, userID uuid.UUID, event, ipAddress, userAgent string, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	var owner *uuid.UUID
+	if userID != uuid.Nil {
+		owner = &userID
+	}
+
+	_, err = exec.Exec(`
+		INSERT INTO audit_events (id, user_id, event, ip_address, user_agent, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New(), owner, event, ipAddress, userAgent, encoded, time.Now())
+	return err
+}
+
+func EachUserAuditEvent(userID uuid.UUID, fn func(models.AuditEvent) error) error {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, user_id, event, ip_address, user_agent, metadata, created_at
+		FROM audit_events
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.Event, &event.IPAddress, &event.UserAgent, &event.Metadata, &event.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,59 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+// EachUserTodo walks every todo of the user, archived ones included, without
+// loading them all into memory.
+func EachUserTodo(userID uuid.UUID, fn func(models.Todo) error) error {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, user_id, title, description, status, due_date, created_at, updated_at, archived_at
+		FROM todo
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task models.Todo
+		err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.DueDate, &task.CreatedAt, &task.UpdatedAt, &task.ArchivedAt)
+		if err != nil {
+			return err
+		}
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListAllUserSessions includes expired sessions that have not been reaped yet.
+func ListAllUserSessions(userID uuid.UUID) ([]models.UserSession, error) {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, user_id, created_at, expires_at, last_seen_at, ip_address, user_agent
+		FROM user_sessions
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		err := rows.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt, &session.IPAddress, &session.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
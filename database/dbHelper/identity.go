@@ -0,0 +1,61 @@
+package dbHelper
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+)
+
+// GetUserIDByIdentity returns the user linked to an external identity and
+// whether that user is archived.
+func GetUserIDByIdentity(provider, subject string) (uuid.UUID, bool, error) {
+	var userID uuid.UUID
+	var archived bool
+	err := database.TodoEx.QueryRow(`
+		SELECT u.id, u.archived_at IS NOT NULL
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2`, provider, subject).
+		Scan(&userID, &archived)
+	return userID, archived, err
+}
+
+func CreateUserIdentity(exec SQLExecutor, userID uuid.UUID, provider, subject, email string) error {
+	now := time.Now()
+	_, err := exec.Exec(`
+		INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New(), userID, provider, subject, email, now, now)
+	return err
+}
+
+func TouchUserIdentity(provider, subject, email string) error {
+	_, err := database.TodoEx.Exec(`
+		UPDATE user_identities
+		SET last_login_at = $1, email = $2
+		WHERE provider = $3 AND subject = $4`, time.Now(), email, provider, subject)
+	return err
+}
+
+func CreateOIDCLoginState(stateHash, bindingHash, codeVerifier, nonce string, cookieMode bool) error {
+	now := time.Now()
+	_, err := database.TodoEx.Exec(`
+		INSERT INTO oidc_login_states (state_hash, binding_hash, code_verifier, nonce, cookie_mode, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		stateHash, bindingHash, codeVerifier, nonce, cookieMode, now, now.Add(config.OIDCLoginStateLifetime))
+	return err
+}
+
+// ConsumeOIDCLoginState deletes the state and returns what was stored with it,
+// so each authorization response can be redeemed only once. The binding must
+// come from the browser that started the login.
+func ConsumeOIDCLoginState(stateHash, bindingHash string) (codeVerifier, nonce string, cookieMode bool, err error) {
+	err = database.TodoEx.QueryRow(`
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND binding_hash = $2 AND expires_at > NOW()
+		RETURNING code_verifier, nonce, cookie_mode`, stateHash, bindingHash).
+		Scan(&codeVerifier, &nonce, &cookieMode)
+	return codeVerifier, nonce, cookieMode, err
+}
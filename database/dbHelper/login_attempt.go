@@ -0,0 +1,67 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+)
+
+// GetLoginLockout returns the latest lock that is still active on any of the
+// keys, or the zero time when none is.
+func GetLoginLockout(keys ...string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := database.TodoEx.QueryRow(`
+		SELECT MAX(locked_until) FROM login_attempts
+		WHERE key = ANY($1) AND locked_until > NOW()`, pq.Array(keys)).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordLoginFailure counts a failure against key and, once maxFailures is
+// reached, locks it out for LoginLockoutBase doubled for every further
+// failure, capped at LoginLockoutMax. Failures older than LoginFailureWindow
+// are forgotten. It returns the lock expiry, or the zero time.
+func RecordLoginFailure(key string, maxFailures int) (time.Time, error) {
+	now := time.Now()
+	var failures int
+	err := database.TodoEx.QueryRow(`
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < $3 AND
+					(login_attempts.locked_until IS NULL OR login_attempts.locked_until < $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = $2
+		RETURNING failures`, key, now, now.Add(-config.LoginFailureWindow)).Scan(&failures)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if failures < maxFailures {
+		return time.Time{}, nil
+	}
+
+	lockout := config.LoginLockoutBase
+	for i := maxFailures; i < failures && lockout < config.LoginLockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > config.LoginLockoutMax {
+		lockout = config.LoginLockoutMax
+	}
+
+	lockedUntil := now.Add(lockout)
+	_, err = database.TodoEx.Exec(`UPDATE login_attempts SET locked_until = $1 WHERE key = $2`, lockedUntil, key)
+	return lockedUntil, err
+}
+
+func ClearLoginFailures(key string) error {
+	_, err := database.TodoEx.Exec(`DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,142 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+// GetTOTPSecret returns the user's secret, which is pending until enabledAt is
+// set by a confirmed code.
+func GetTOTPSecret(exec SQLQueryExecutor, userID uuid.UUID) (secret *string, enabledAt *time.Time, err error) {
+	err = exec.QueryRow(`SELECT totp_secret, totp_enabled_at FROM users WHERE id = $1`, userID).Scan(&secret, &enabledAt)
+	return secret, enabledAt, err
+}
+
+func IsTOTPEnabled(userID uuid.UUID) (bool, error) {
+	_, enabledAt, err := GetTOTPSecret(database.TodoEx, userID)
+	return enabledAt != nil, err
+}
+
+func SetPendingTOTPSecret(userID uuid.UUID, secret string) error {
+	_, err := database.TodoEx.Exec(`
+		UPDATE users
+		SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $2 AND totp_enabled_at IS NULL`, secret, userID)
+	return err
+}
+
+func EnableTOTP(exec SQLExecutor, userID uuid.UUID) error {
+	_, err := exec.Exec(`UPDATE users SET totp_enabled_at = $1 WHERE id = $2`, time.Now(), userID)
+	return err
+}
+
+func DisableTOTP(exec SQLExecutor, userID uuid.UUID) error {
+	if _, err := exec.Exec(`
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := exec.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	return err
+}
+
+// UseTOTPStep records step as the last accepted one. It returns false when
+// that step, or a later one, was already used, which stops a code observed by
+// an attacker from being replayed within its validity window.
+func UseTOTPStep(exec SQLExecutor, userID uuid.UUID, step int64) (bool, error) {
+	result, err := exec.Exec(`
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`, step, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func ReplaceRecoveryCodes(exec SQLExecutor, userID uuid.UUID, codeHashes []string) error {
+	if _, err := exec.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		_, err := exec.Exec(`
+			INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at)
+			VALUES ($1, $2, $3, $4)`, uuid.New(), userID, codeHash, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ConsumeRecoveryCode(exec SQLExecutor, userID uuid.UUID, codeHash string) (bool, error) {
+	result, err := exec.Exec(`
+		UPDATE mfa_recovery_codes
+		SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CreateMFAChallenge remembers how the login should finish: the auth method
+// and, for sessions, whether the token goes into a cookie.
+func CreateMFAChallenge(userID uuid.UUID, tokenHash, method string, cookieMode bool) error {
+	now := time.Now()
+	_, err := database.TodoEx.Exec(`
+		INSERT INTO mfa_challenges (id, user_id, token_hash, method, cookie_mode, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New(), userID, tokenHash, method, cookieMode, now, now.Add(config.MFAChallengeLifetime))
+	return err
+}
+
+// GetMFAChallengeEmail returns the email of the user a redeemable challenge
+// belongs to, which keys the login throttle.
+func GetMFAChallengeEmail(tokenHash string) (string, error) {
+	var email string
+	err := database.TodoEx.QueryRow(`
+		SELECT u.email
+		FROM mfa_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1 AND c.used_at IS NULL AND c.expires_at > NOW() AND c.attempts < $2`,
+		tokenHash, config.MFAMaxAttempts).Scan(&email)
+	return email, err
+}
+
+// GetMFAChallengeForUpdate only returns challenges that are still redeemable.
+func GetMFAChallengeForUpdate(tx *sql.Tx, tokenHash string) (models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+
+	err := tx.QueryRow(`
+		SELECT id, user_id, token_hash, method, attempts, cookie_mode, created_at, expires_at, used_at
+		FROM mfa_challenges
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2
+		FOR UPDATE`, tokenHash, config.MFAMaxAttempts).
+		Scan(&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.Method, &challenge.Attempts, &challenge.CookieMode,
+			&challenge.CreatedAt, &challenge.ExpiresAt, &challenge.UsedAt)
+	if err != nil {
+		return models.MFAChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+func RecordMFAChallengeFailure(exec SQLExecutor, id uuid.UUID) error {
+	_, err := exec.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, id)
+	return err
+}
+
+func MarkMFAChallengeUsed(exec SQLExecutor, id uuid.UUID) error {
+	_, err := exec.Exec(`UPDATE mfa_challenges SET used_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
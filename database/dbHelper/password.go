@@ -0,0 +1,53 @@
+package dbHelper
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+)
+
+func GetUserIDByEmail(email string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := database.TodoEx.QueryRow(`
+		SELECT id FROM users
+		WHERE LOWER(email) = LOWER($1) AND archived_at IS NULL`, email).Scan(&id)
+	return id, err
+}
+
+func UpdateUserPassword(exec SQLExecutor, userID uuid.UUID, hashedPassword string) error {
+	_, err := exec.Exec(`UPDATE users SET password = $1 WHERE id = $2`, hashedPassword, userID)
+	return err
+}
+
+func CreatePasswordResetToken(exec SQLExecutor, userID uuid.UUID, tokenHash string) error {
+	now := time.Now()
+	_, err := exec.Exec(`
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		uuid.New(), userID, tokenHash, now, now.Add(config.PasswordResetTokenLifetime))
+	return err
+}
+
+// ConsumePasswordResetToken marks the token used and returns its owner in a
+// single statement, so a token can never be redeemed twice. Any other
+// outstanding reset tokens of the same user are burned along with it.
+func ConsumePasswordResetToken(exec SQLQueryExecutor, tokenHash string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	now := time.Now()
+	err := exec.QueryRow(`
+		UPDATE password_reset_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`, now, tokenHash).Scan(&userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = exec.Exec(`
+		UPDATE password_reset_tokens
+		SET used_at = $1
+		WHERE user_id = $2 AND used_at IS NULL`, now, userID)
+	return userID, err
+}
@@ -0,0 +1,89 @@
+package dbHelper
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
+)
+
+func CreatePersonalAccessToken(userID uuid.UUID, name, tokenHash string, scopes []string, expiresAt *time.Time) (models.PersonalAccessToken, error) {
+	token := models.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	_, err := database.TodoEx.Exec(`
+		INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID, token.UserID, token.Name, tokenHash, pq.Array(token.Scopes), token.CreatedAt, token.ExpiresAt)
+	return token, err
+}
+
+func GetPersonalAccessTokenByToken(token string) (models.PersonalAccessToken, error) {
+	var pat models.PersonalAccessToken
+
+	err := database.TodoEx.QueryRow(`
+		SELECT id, user_id, name, scopes, created_at, expires_at, last_used_at, revoked_at
+		FROM personal_access_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`,
+		utils.HashToken(token)).
+		Scan(&pat.ID, &pat.UserID, &pat.Name, pq.Array(&pat.Scopes), &pat.CreatedAt, &pat.ExpiresAt, &pat.LastUsedAt, &pat.RevokedAt)
+	if err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	return pat, nil
+}
+
+// TouchPersonalAccessToken is debounced the same way as TouchUserSession.
+func TouchPersonalAccessToken(pat models.PersonalAccessToken) error {
+	if pat.LastUsedAt != nil && time.Since(*pat.LastUsedAt) < config.SessionTouchInterval {
+		return nil
+	}
+	_, err := database.TodoEx.Exec(`UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`, time.Now(), pat.ID)
+	return err
+}
+
+func ListPersonalAccessTokens(userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, user_id, name, scopes, created_at, expires_at, last_used_at, revoked_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]models.PersonalAccessToken, 0)
+	for rows.Next() {
+		var pat models.PersonalAccessToken
+		err := rows.Scan(&pat.ID, &pat.UserID, &pat.Name, pq.Array(&pat.Scopes), &pat.CreatedAt, &pat.ExpiresAt, &pat.LastUsedAt, &pat.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, pat)
+	}
+
+	return tokens, rows.Err()
+}
+
+func RevokePersonalAccessToken(userID, tokenID uuid.UUID) (bool, error) {
+	result, err := database.TodoEx.Exec(`
+		UPDATE personal_access_tokens
+		SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`, time.Now(), tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,174 @@
+package dbHelper
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/sirupsen/logrus"
+)
+
+// revokedTokens mirrors the unexpired rows of revoked_tokens so the auth
+// middleware does not hit the database for every JWT. Once loaded it is
+// refreshed in the background every config.RevocationSyncInterval, which also
+// drops entries whose tokens have expired and picks up revocations made by
+// other instances. Requests keep using the last good snapshot meanwhile, so a
+// database hiccup does not fail every JWT request.
+var revokedTokens = &revocationCache{entries: map[string]time.Time{}}
+
+type revocationCache struct {
+	mu          sync.RWMutex
+	entries     map[string]time.Time
+	loaded      bool
+	attemptedAt time.Time
+
+	syncMu     sync.Mutex
+	refreshing int32
+}
+
+func (c *revocationCache) add(jti string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[jti] = expiresAt
+}
+
+func (c *revocationCache) contains(jti string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	expiresAt, ok := c.entries[jti]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (c *revocationCache) state() (loaded, stale bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loaded, time.Since(c.attemptedAt) > config.RevocationSyncInterval
+}
+
+// load blocks until the first snapshot is in; until then there is nothing
+// safe to fall back on.
+func (c *revocationCache) load() error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	if loaded, _ := c.state(); loaded {
+		return nil
+	}
+	return c.sync()
+}
+
+// refresh starts a background sync unless one is already running.
+func (c *revocationCache) refresh() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.syncMu.Lock()
+		defer c.syncMu.Unlock()
+		if err := c.sync(); err != nil {
+			logrus.WithError(err).Warn("failed to refresh revoked tokens, keeping the last snapshot")
+		}
+	}()
+}
+
+func (c *revocationCache) sync() error {
+	// failed attempts count too, so a struggling database is retried once
+	// per interval rather than on every request
+	c.mu.Lock()
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	rows, err := database.TodoEx.Query(`SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > NOW()`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	entries := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return err
+		}
+		entries[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// keep local revocations made while the query ran; revocations are never
+	// lifted, so only expired entries may go
+	now := time.Now()
+	for jti, expiresAt := range c.entries {
+		if _, ok := entries[jti]; !ok && now.Before(expiresAt) {
+			entries[jti] = expiresAt
+		}
+	}
+	c.entries = entries
+	c.loaded = true
+	return nil
+}
+
+func RevokeToken(jti string, userID uuid.UUID, expiresAt time.Time) error {
+	_, err := database.TodoEx.Exec(`
+		INSERT INTO revoked_tokens (jti, user_id, revoked_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, time.Now(), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	revokedTokens.add(jti, expiresAt)
+	return nil
+}
+
+func IsTokenRevoked(jti string) (bool, error) {
+	loaded, stale := revokedTokens.state()
+	if !loaded {
+		if err := revokedTokens.load(); err != nil {
+			return false, err
+		}
+	} else if stale {
+		revokedTokens.refresh()
+	}
+	return revokedTokens.contains(jti), nil
+}
+
+// RevokeAllUserTokens invalidates every credential the user holds: JWTs issued
+// before now, all refresh token families, all opaque sessions and all personal
+// access tokens.
+func RevokeAllUserTokens(exec SQLExecutor, userID uuid.UUID) error {
+	if err := RevokeOtherUserTokens(exec, userID, uuid.Nil); err != nil {
+		return err
+	}
+	_, err := exec.Exec(`
+		UPDATE personal_access_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL`, time.Now(), userID)
+	return err
+}
+
+// RevokeOtherUserTokens revokes the user's JWTs, refresh tokens and every
+// opaque session except keepSessionID. Personal access tokens are left alone
+// since automation should survive a routine password change.
+func RevokeOtherUserTokens(exec SQLExecutor, userID, keepSessionID uuid.UUID) error {
+	now := time.Now()
+	if _, err := exec.Exec(`UPDATE users SET tokens_revoked_at = $1 WHERE id = $2`, now, userID); err != nil {
+		return err
+	}
+	if _, err := exec.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+	_, err := DeleteOtherUserSessions(exec, userID, keepSessionID)
+	return err
+}
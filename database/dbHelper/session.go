@@ -0,0 +1,97 @@
+package dbHelper
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
+)
+
+func GetUserSessionByToken(sessionToken string) (models.UserSession, error) {
+	var session models.UserSession
+
+	err := database.TodoEx.QueryRow(`
+		SELECT id, user_id, created_at, expires_at, last_seen_at, ip_address, user_agent
+		FROM user_sessions
+		WHERE token_hash = $1 AND expires_at > NOW() AND last_seen_at > $2`,
+		utils.HashToken(sessionToken), idleCutoff()).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt, &session.IPAddress, &session.UserAgent)
+	if err != nil {
+		return models.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+// idleCutoff is the oldest last_seen_at a session may have and still be usable.
+func idleCutoff() time.Time {
+	return time.Now().Add(-config.SessionIdleTimeout)
+}
+
+// TouchUserSession slides the idle window forward. It is debounced by
+// config.SessionTouchInterval so an active client does not cause a write on
+// every request; the check uses the row itself, so it holds across replicas.
+func TouchUserSession(session models.UserSession) error {
+	if time.Since(session.LastSeenAt) < config.SessionTouchInterval {
+		return nil
+	}
+	_, err := database.TodoEx.Exec(`UPDATE user_sessions SET last_seen_at = $1 WHERE id = $2`, time.Now(), session.ID)
+	return err
+}
+
+// SessionExpiry is when the session ends if it sees no further activity.
+func SessionExpiry(session models.UserSession) time.Time {
+	idleExpiry := session.LastSeenAt.Add(config.SessionIdleTimeout)
+	if idleExpiry.Before(session.ExpiresAt) {
+		return idleExpiry
+	}
+	return session.ExpiresAt
+}
+
+func ListUserSessions(userID uuid.UUID) ([]models.UserSession, error) {
+	rows, err := database.TodoEx.Query(`
+		SELECT id, user_id, created_at, expires_at, last_seen_at, ip_address, user_agent
+		FROM user_sessions
+		WHERE user_id = $1 AND expires_at > NOW() AND last_seen_at > $2
+		ORDER BY last_seen_at DESC`, userID, idleCutoff())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		err := rows.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt, &session.IPAddress, &session.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession returns false when the session does not exist or belongs
+// to someone else.
+func DeleteUserSession(userID, sessionID uuid.UUID) (bool, error) {
+	result, err := database.TodoEx.Exec(`DELETE FROM user_sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// DeleteOtherUserSessions removes every session of the user except keepID,
+// which may be uuid.Nil to remove them all.
+func DeleteOtherUserSessions(exec SQLExecutor, userID, keepID uuid.UUID) (int64, error) {
+	result, err := exec.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2`, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
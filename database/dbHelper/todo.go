@@ -1,5 +1,23 @@
 package dbHelper
 
+import (
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+// GetUserTodo returns a live todo only if it belongs to the user, so callers
+// cannot tell someone else's todo from a missing one.
+func GetUserTodo(userID, todoID uuid.UUID) (models.Todo, error) {
+	var task models.Todo
+	err := database.TodoEx.QueryRow(`
+		SELECT id, user_id, title, description, status, due_date, created_at, updated_at, archived_at
+		FROM todo
+		WHERE id = $1 AND user_id = $2 AND archived_at IS NULL`, todoID, userID).
+		Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.DueDate, &task.CreatedAt, &task.UpdatedAt, &task.ArchivedAt)
+	return task, err
+}
+
 // "net/http"
 // "database/sql"
 // "time"
@@ -0,0 +1,172 @@
+package dbHelper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+const TodoStatusCompleted = "completed"
+
+// todoSortColumns maps each sort field to the expression it orders by and the
+// type its cursor value is cast back to. Todos without a due date sort as if
+// due at infinity, so keyset comparisons never meet a NULL.
+var todoSortColumns = map[string]struct {
+	expr string
+	cast string
+}{
+	"created_at": {"created_at", "timestamptz"},
+	"due_date":   {"COALESCE(due_date, 'infinity'::timestamptz)", "timestamptz"},
+	"title":      {"title", "text"},
+}
+
+func IsTodoSortField(field string) bool {
+	_, ok := todoSortColumns[field]
+	return ok
+}
+
+// TodoCursor marks the last todo of a page. Key is the sort value as text, so
+// it round-trips through Postgres without losing precision.
+type TodoCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Key        string    `json:"k"`
+	ID         uuid.UUID `json:"i"`
+}
+
+// todoCursorTimeLayouts are how Postgres prints a timestamptz with the
+// default ISO DateStyle; the offset is as long as the session zone needs.
+var todoCursorTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05.999999-07:00",
+	"2006-01-02 15:04:05.999999-07:00:00",
+}
+
+// Valid reports whether the key can be cast back to the type its sort field
+// orders by, so a tampered cursor is rejected before it reaches the query.
+// Any text is a valid title key, including the empty one.
+func (c *TodoCursor) Valid() bool {
+	column, ok := todoSortColumns[c.Sort]
+	if !ok || c.ID == uuid.Nil {
+		return false
+	}
+	if column.cast == "timestamptz" {
+		if c.Key == "infinity" {
+			return true
+		}
+		for _, layout := range todoCursorTimeLayouts {
+			if _, err := time.Parse(layout, c.Key); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return !strings.ContainsRune(c.Key, 0)
+}
+
+type TodoListFilter struct {
+	Statuses      []string
+	DueBefore     *time.Time
+	DueAfter      *time.Time
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	Overdue       bool
+	Sort          string
+	Descending    bool
+	Limit         int
+	After         *TodoCursor
+}
+
+// ListTodos returns one page of the user's live todos and the cursor of the
+// next page, which is nil on the last one.
+func ListTodos(userID uuid.UUID, filter TodoListFilter) ([]models.Todo, *TodoCursor, error) {
+	column, ok := todoSortColumns[filter.Sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown sort field %q", filter.Sort)
+	}
+
+	args := []interface{}{userID}
+	conds := []string{"user_id = $1", "archived_at IS NULL"}
+	add := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(format, len(args)))
+	}
+
+	if len(filter.Statuses) > 0 {
+		add("status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.DueBefore != nil {
+		add("due_date < $%d", filter.DueBefore.UTC())
+	}
+	if filter.DueAfter != nil {
+		add("due_date >= $%d", filter.DueAfter.UTC())
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < $%d", filter.CreatedBefore.UTC())
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= $%d", filter.CreatedAfter.UTC())
+	}
+	if filter.Overdue {
+		add("due_date < $%d", time.Now().UTC())
+		add("status <> $%d", TodoStatusCompleted)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.Key, filter.After.ID)
+		conds = append(conds, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)",
+			column.expr, comparison, len(args)-1, column.cast, len(args)))
+	}
+
+	// one extra row tells whether there is a next page
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT id, user_id, title, description, status, due_date, created_at, updated_at, archived_at, (%s)::text
+		FROM todo
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT $%d`,
+		column.expr, strings.Join(conds, " AND "), column.expr, direction, direction, len(args))
+
+	rows, err := database.TodoEx.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]models.Todo, 0, filter.Limit+1)
+	var keys []string
+	for rows.Next() {
+		var task models.Todo
+		var key string
+		if err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.DueDate, &task.CreatedAt, &task.UpdatedAt, &task.ArchivedAt, &key); err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, task)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(tasks) <= filter.Limit {
+		return tasks, nil, nil
+	}
+	tasks = tasks[:filter.Limit]
+	last := len(tasks) - 1
+	return tasks, &TodoCursor{
+		Sort:       filter.Sort,
+		Descending: filter.Descending,
+		Key:        keys[last],
+		ID:         tasks[last].ID,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package dbHelper
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+// Postgres wraps matches in these private-use characters, which survive HTML
+// escaping and are then swapped for <mark> tags. Highlighting with <mark>
+// directly would pass the user's own markup through unescaped.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+	headlineOpts   = "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+)
+
+type TodoSearchResult struct {
+	Todo               models.Todo `json:"todo"`
+	Rank               float64     `json:"rank"`
+	TitleSnippet       string      `json:"title_snippet"`
+	DescriptionSnippet string      `json:"description_snippet,omitempty"`
+}
+
+// SearchTodos ranks the user's todos against q. q takes web search syntax
+// ("exact phrase", or, -exclude) plus prefix terms such as deploy*.
+func SearchTodos(userID uuid.UUID, q string, includeArchived bool, limit, offset int) ([]TodoSearchResult, error) {
+	websearch, prefixes := splitSearchQuery(q)
+
+	// $1..$6 are fixed; every prefix term adds one more parameter
+	args := []interface{}{userID, websearch, headlineOpts, includeArchived, limit, offset}
+	query := "websearch_to_tsquery('english', $2)"
+	for _, prefix := range prefixes {
+		args = append(args, prefix+":*")
+		query += fmt.Sprintf(" && to_tsquery('english', $%d)", len(args))
+	}
+
+	rows, err := database.TodoEx.Query(fmt.Sprintf(`
+		WITH q AS (SELECT %s AS query)
+		SELECT t.id, t.user_id, t.title, t.description, t.status, t.due_date, t.created_at, t.updated_at, t.archived_at,
+			ts_rank_cd(t.search_vector, q.query) AS rank,
+			ts_headline('english', t.title, q.query, $3 || ', HighlightAll=true'),
+			ts_headline('english', COALESCE(t.description, ''), q.query, $3 || ', MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM todo t, q
+		WHERE t.user_id = $1
+			AND ($4 OR t.archived_at IS NULL)
+			AND t.search_vector @@ q.query
+		ORDER BY rank DESC, t.created_at DESC, t.id
+		LIMIT $5 OFFSET $6`, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]TodoSearchResult, 0)
+	for rows.Next() {
+		var result TodoSearchResult
+		task := &result.Todo
+		if err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.DueDate, &task.CreatedAt, &task.UpdatedAt, &task.ArchivedAt,
+			&result.Rank, &result.TitleSnippet, &result.DescriptionSnippet); err != nil {
+			return nil, err
+		}
+		result.TitleSnippet = markHighlights(result.TitleSnippet)
+		result.DescriptionSnippet = markHighlights(result.DescriptionSnippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// splitSearchQuery moves unquoted terms ending in * out of q, keeping only
+// their letters and digits so they cannot inject tsquery operators. Excluded
+// terms (-word*) stay in q, where the * is ignored.
+func splitSearchQuery(q string) (string, []string) {
+	var rest []string
+	var prefixes []string
+	inQuote := false
+	for _, field := range strings.Fields(q) {
+		quotes := strings.Count(field, `"`)
+		if !inQuote && quotes == 0 && strings.HasSuffix(field, "*") && !strings.HasPrefix(field, "-") {
+			lexeme := strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					return unicode.ToLower(r)
+				}
+				return -1
+			}, field)
+			if lexeme != "" {
+				prefixes = append(prefixes, lexeme)
+			}
+			continue
+		}
+		if quotes%2 == 1 {
+			inQuote = !inQuote
+		}
+		rest = append(rest, field)
+	}
+	return strings.Join(rest, " "), prefixes
+}
+
+func markHighlights(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
@@ -0,0 +1,61 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+func CreateRefreshToken(exec SQLExecutor, userID, familyID uuid.UUID, tokenHash string) error {
+	now := time.Now()
+	_, err := exec.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.New(), userID, familyID, tokenHash, now, now.Add(config.RefreshTokenLifetime))
+	return err
+}
+
+// GetRefreshTokenForUpdate locks the row so two concurrent refreshes with the
+// same token cannot both succeed.
+func GetRefreshTokenForUpdate(tx *sql.Tx, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	err := tx.QueryRow(`
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+
+	return token, nil
+}
+
+func MarkRefreshTokenUsed(exec SQLExecutor, id uuid.UUID) error {
+	_, err := exec.Exec(`UPDATE refresh_tokens SET used_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+func RevokeRefreshTokenFamily(exec SQLExecutor, familyID uuid.UUID) error {
+	_, err := exec.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE family_id = $2 AND revoked_at IS NULL`, time.Now(), familyID)
+	return err
+}
+
+func RevokeRefreshTokenFamilyByToken(exec SQLExecutor, userID uuid.UUID, tokenHash string) error {
+	_, err := exec.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM refresh_tokens
+			WHERE token_hash = $2 AND user_id = $3
+		)`, time.Now(), tokenHash, userID)
+	return err
+}
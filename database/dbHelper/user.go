@@ -2,20 +2,29 @@ package dbHelper
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ray-remotestate/todoEx/config"
 	"github.com/sirupsen/logrus"
 	"github.com/ray-remotestate/todoEx/database"
 	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
 )
 
 type SQLExecutor interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
+// SQLQueryExecutor is satisfied by both *sql.DB and *sql.Tx.
+type SQLQueryExecutor interface {
+	SQLExecutor
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func CreateUser(tx *sql.Tx, name, email, hashedPassword string) (uuid.UUID, error) {
 	id := uuid.New()
 	createdAt := time.Now().UTC()
@@ -30,12 +39,13 @@ func IsUserExists(email string) (bool, error) {
 	return count > 0, err
 }
 
-func CreateUserSession(exec SQLExecutor, userID uuid.UUID, token string) error {
-	expiresAt := time.Now().Add(120 * time.Hour)
+func CreateUserSession(exec SQLExecutor, userID uuid.UUID, token, ipAddress, userAgent string) error {
+	now := time.Now()
+	expiresAt := now.Add(config.SessionLifetime)
 	_, err := exec.Exec(`
-		INSERT INTO user_sessions (id, user_id, session_token, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5)`,
-		uuid.New(), userID, token, time.Now(), expiresAt)
+		INSERT INTO user_sessions (id, user_id, token_hash, created_at, expires_at, last_seen_at, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		uuid.New(), userID, utils.HashToken(token), now, expiresAt, now, ipAddress, userAgent)
 	return err
 }
 
@@ -51,33 +61,55 @@ func GetUserIDByPassword(email, password string) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
-		return uuid.Nil, fmt.Errorf("incorrect password")
+	needsRehash, err := checkPassword(hashedPassword, password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if needsRehash {
+		if err := rehashPassword(id, hashedPassword, password); err != nil {
+			logrus.WithError(err).Warn("failed to upgrade password hash")
+		}
 	}
 
 	return id, nil
 }
 
-func GetUserIDBySession(sessionToken string) (uuid.UUID, error) {
-	var userID uuid.UUID
-
-	err := database.TodoEx.QueryRow(`
-		SELECT user_id FROM user_sessions
-		WHERE session_token = $1 AND expires_at > NOW()`, sessionToken).Scan(&userID)
+func checkPassword(hashedPassword, password string) (bool, error) {
+	ok, needsRehash, err := utils.VerifyPassword(hashedPassword, password)
 	if err != nil {
-		return uuid.Nil, err
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("incorrect password")
 	}
+	return needsRehash, nil
+}
 
-	return userID, nil
+// rehashPassword replaces an outdated hash after a successful login. It only
+// applies if the stored hash is still the one that was checked, so a password
+// change racing with the login is never undone.
+func rehashPassword(userID uuid.UUID, oldHash, password string) error {
+	newHash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = database.TodoEx.Exec(`UPDATE users SET password = $1 WHERE id = $2 AND password = $3`, newHash, userID, oldHash)
+	return err
 }
 
 func GetUserByUserID(userID uuid.UUID) (models.User, error) {
+	return GetUserByUserIDWith(database.TodoEx, userID)
+}
+
+// GetUserByUserIDWith reads the user through exec, e.g. inside a transaction.
+func GetUserByUserIDWith(exec SQLQueryExecutor, userID uuid.UUID) (models.User, error) {
 	var user models.User
 
-	err := database.TodoEx.QueryRow(`
-		SELECT id, name, email, password, created_at, archived_at FROM users
+	err := exec.QueryRow(`
+		SELECT id, name, email, password, role, created_at, archived_at, tokens_revoked_at, email_verified_at, timezone, preferences FROM users
 		WHERE id = $1 AND archived_at IS NULL`, userID).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.ArchivedAt)
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.ArchivedAt, &user.TokensRevokedAt, &user.EmailVerifiedAt,
+			&user.Timezone, &user.Preferences)
 	if err != nil {
 		logrus.Printf("%v", err) // remove later (just debugging)
 		return models.User{}, err
@@ -85,3 +117,10 @@ func GetUserByUserID(userID uuid.UUID) (models.User, error) {
 
 	return user, nil
 }
+
+// IsUniqueViolation reports whether err was caused by a unique index, such as
+// active_user when two live accounts would share an email.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,49 @@
+package dbHelper
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+)
+
+// CreateEmailVerificationToken supersedes the user's outstanding tokens, so
+// confirming an old registration or email change link cannot set the email
+// back to an address the user has since moved away from.
+func CreateEmailVerificationToken(exec SQLExecutor, userID uuid.UUID, email, tokenHash string) error {
+	now := time.Now()
+	if _, err := exec.Exec(`
+		UPDATE email_verification_tokens
+		SET used_at = $1
+		WHERE user_id = $2 AND used_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+	_, err := exec.Exec(`
+		INSERT INTO email_verification_tokens (id, user_id, email, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.New(), userID, email, tokenHash, now, now.Add(config.EmailVerificationTokenLifetime))
+	return err
+}
+
+// ConsumeEmailVerificationToken marks the token used and returns the user and
+// the address it was issued for.
+func ConsumeEmailVerificationToken(exec SQLQueryExecutor, tokenHash string) (uuid.UUID, string, error) {
+	var userID uuid.UUID
+	var email string
+	err := exec.QueryRow(`
+		UPDATE email_verification_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id, email`, time.Now(), tokenHash).Scan(&userID, &email)
+	return userID, email, err
+}
+
+// MarkEmailVerified sets the verified address, which may differ from the
+// current one when the user is changing their email.
+func MarkEmailVerified(exec SQLExecutor, userID uuid.UUID, email string) error {
+	_, err := exec.Exec(`
+		UPDATE users
+		SET email = $1, email_verified_at = $2
+		WHERE id = $3 AND archived_at IS NULL`, email, time.Now(), userID)
+	return err
+}
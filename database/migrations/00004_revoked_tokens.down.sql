@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_at;
+
+DROP INDEX IF EXISTS revoked_tokens_expires_at;
+DROP TABLE IF EXISTS revoked_tokens;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS user_sessions_user_id;
+
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS last_seen_at;
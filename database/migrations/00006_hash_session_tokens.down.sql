@@ -0,0 +1,4 @@
+-- digests cannot be turned back into bearer tokens, so every session is invalidated
+DELETE FROM user_sessions;
+
+ALTER TABLE user_sessions RENAME COLUMN token_hash TO session_token;
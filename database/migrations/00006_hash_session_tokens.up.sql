@@ -0,0 +1,4 @@
+ALTER TABLE user_sessions RENAME COLUMN session_token TO token_hash;
+
+-- existing sessions stay valid: their tokens are replaced by the same SHA-256 digest the application now looks up by
+UPDATE user_sessions SET token_hash = encode(digest(token_hash, 'sha256'), 'hex');
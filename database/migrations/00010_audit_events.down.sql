@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS audit_events_user_id;
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS active_personal_access_token;
+DROP TABLE IF EXISTS personal_access_tokens;
@@ -0,0 +1 @@
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS cookie_mode BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS todo_user_title;
+DROP INDEX IF EXISTS todo_user_due_date;
+DROP INDEX IF EXISTS todo_user_created_at;
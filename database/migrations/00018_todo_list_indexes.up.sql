@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS todo_user_created_at ON todo(user_id, created_at, id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS todo_user_due_date ON todo(user_id, (COALESCE(due_date, 'infinity'::timestamp)), id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS todo_user_title ON todo(user_id, title, id) WHERE archived_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS todo_search_vector;
+ALTER TABLE todo DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1 @@
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS binding_hash TEXT NOT NULL DEFAULT '';
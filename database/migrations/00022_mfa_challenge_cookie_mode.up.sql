@@ -0,0 +1 @@
+ALTER TABLE mfa_challenges ADD COLUMN IF NOT EXISTS cookie_mode BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS todo_user_due_date;
+ALTER TABLE todo
+    ALTER COLUMN due_date TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN archived_at TYPE TIMESTAMP;
+CREATE INDEX IF NOT EXISTS todo_user_due_date ON todo(user_id, (COALESCE(due_date, 'infinity'::timestamp)), id) WHERE archived_at IS NULL;
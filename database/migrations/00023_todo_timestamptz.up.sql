@@ -0,0 +1,8 @@
+-- the old values are wall-clock times and are read in the session time zone;
+-- run this with PGTZ set to the app host's zone if it differs from the database's
+DROP INDEX IF EXISTS todo_user_due_date;
+ALTER TABLE todo
+    ALTER COLUMN due_date TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN archived_at TYPE TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS todo_user_due_date ON todo(user_id, (COALESCE(due_date, 'infinity'::timestamptz)), id) WHERE archived_at IS NULL;
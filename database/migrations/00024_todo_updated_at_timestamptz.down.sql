@@ -0,0 +1 @@
+ALTER TABLE todo ALTER COLUMN updated_at TYPE TIMESTAMP;
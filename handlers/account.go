@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/mailer"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangePassword keeps the session that made the request alive and revokes
+// every other credential. A JWT caller's own token is revoked as well, so it
+// gets a fresh access/refresh pair in the response.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	principal := middlewares.PrincipalContext(r)
+	if user == nil || principal == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !reauthenticate(w, r, user.Email, body.CurrentPassword, "current password is incorrect") {
+		return
+	}
+
+	if violatesPasswordPolicy(w, "new_password", body.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(body.NewPassword)
+	if err != nil {
+		http.Error(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	var refreshToken string
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		if err := dbHelper.UpdateUserPassword(tx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		if err := dbHelper.RevokeOtherUserTokens(tx, user.ID, currentSessionID(principal)); err != nil {
+			return err
+		}
+		if principal.Method != middlewares.AuthMethodJWT {
+			return nil
+		}
+		var err error
+		refreshToken, err = issueRefreshToken(tx, user.ID, uuid.New())
+		return err
+	})
+	if txErr != nil {
+		http.Error(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditPasswordChanged, nil)
+
+	response := map[string]string{
+		"message": "Password changed",
+	}
+	if principal.Method == middlewares.AuthMethodJWT {
+		JWTToken, err := utils.CreateJWTToken(user.ID)
+		if err != nil {
+			http.Error(w, "failed to create JWT token", http.StatusInternalServerError)
+			return
+		}
+		response["token"] = JWTToken
+		response["refresh_token"] = refreshToken
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ChangeEmail does not touch users.email directly: the new address only
+// replaces the old one once it is confirmed through /verify-email.
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Password string `json:"password"`
+		NewEmail string `json:"new_email"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !reauthenticate(w, r, user.Email, body.Password, "password is incorrect") {
+		return
+	}
+
+	if !utils.IsValidEmail(body.NewEmail) {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(body.NewEmail, user.Email) {
+		http.Error(w, "new email address is the same as the current one", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := dbHelper.IsUserExists(body.NewEmail)
+	if err != nil {
+		http.Error(w, "failed to check user existence", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "email address is already in use", http.StatusConflict)
+		return
+	}
+
+	if err := sendEmailVerification(user.ID, body.NewEmail); err != nil {
+		http.Error(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditEmailChangeRequest, map[string]interface{}{"new_email": body.NewEmail})
+
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your todoEx email address is being changed",
+		Body: fmt.Sprintf("A request was made to change the email address of your todoEx account to %s.\n\n"+
+			"If it wasn't you, reset your password right away.", body.NewEmail),
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to notify old email address")
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message": "Confirm the new email address using the link sent to it"}`))
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Name        *string         `json:"name"`
+		Timezone    *string         `json:"timezone"`
+		Preferences json.RawMessage `json:"preferences"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			http.Error(w, "name must not be empty", http.StatusBadRequest)
+			return
+		}
+		user.Name = name
+	}
+	if body.Timezone != nil {
+		if _, err := time.LoadLocation(*body.Timezone); err != nil || *body.Timezone == "" || *body.Timezone == "Local" {
+			http.Error(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+		user.Timezone = *body.Timezone
+	}
+	if body.Preferences != nil {
+		var preferences map[string]interface{}
+		if err := json.Unmarshal(body.Preferences, &preferences); err != nil || preferences == nil {
+			http.Error(w, "preferences must be a JSON object", http.StatusBadRequest)
+			return
+		}
+		user.Preferences = body.Preferences
+	}
+
+	if err := dbHelper.UpdateUserProfile(user.ID, user.Name, user.Timezone, user.Preferences); err != nil {
+		http.Error(w, "failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteAccount archives the account rather than deleting it; it can be
+// brought back through /account/restore until the grace period runs out.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Password string `json:"password"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !reauthenticate(w, r, user.Email, body.Password, "password is incorrect") {
+		return
+	}
+
+	archivedAt := time.Now()
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.ArchiveUser(tx, user.ID, archivedAt)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditAccountArchived, nil)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":          "Account deleted",
+		"restorable_until": archivedAt.Add(config.AccountDeletionGracePeriod).UTC().Format(time.RFC3339),
+	})
+}
+
+func RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if loginLocked(w, r, body.Email) {
+		return
+	}
+
+	since := time.Now().Add(-config.AccountDeletionGracePeriod)
+	userID, archivedAt, err := dbHelper.GetArchivedUserIDByPassword(body.Email, body.Password, since)
+	if err != nil {
+		loginFailed(w, r, body.Email)
+		return
+	}
+	loginSucceeded(r, body.Email)
+
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.RestoreUser(tx, userID, archivedAt)
+	})
+	if dbHelper.IsUniqueViolation(txErr) {
+		http.Error(w, "email address is already in use by another account", http.StatusConflict)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to restore account", http.StatusInternalServerError)
+		return
+	}
+	audit(r, userID, auditAccountRestored, nil)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Account restored, please log in again"}`))
+}
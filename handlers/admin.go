@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/maintenance"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+const (
+	adminListDefaultLimit = 50
+	adminListMaxLimit     = 200
+)
+
+// adminTarget loads the user named in the route, archived or not. It reports
+// whether it wrote a response.
+func adminTarget(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return models.User{}, true
+	}
+
+	user, err := dbHelper.GetAnyUserByID(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return models.User{}, true
+	} else if err != nil {
+		http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		return models.User{}, true
+	}
+	return user, false
+}
+
+func AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	switch status {
+	case "":
+		status = dbHelper.UserStatusAll
+	case dbHelper.UserStatusActive, dbHelper.UserStatusArchived, dbHelper.UserStatusAll:
+	default:
+		http.Error(w, "status must be active, archived or all", http.StatusBadRequest)
+		return
+	}
+
+	limit := adminListDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > adminListMaxLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(adminListMaxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	users, err := dbHelper.ListUsers(query.Get("q"), status, limit, offset)
+	if err != nil {
+		http.Error(w, "failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(users)
+}
+
+func AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, done := adminTarget(w, r)
+	if done {
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+func AdminArchiveUser(w http.ResponseWriter, r *http.Request) {
+	admin := middlewares.UserContext(r)
+	user, done := adminTarget(w, r)
+	if done {
+		return
+	}
+	if user.ID == admin.ID {
+		http.Error(w, "use DELETE /api/me to delete your own account", http.StatusBadRequest)
+		return
+	}
+	if user.ArchivedAt != nil {
+		http.Error(w, "user is already archived", http.StatusConflict)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.ArchiveUser(tx, user.ID, time.Now())
+	})
+	if txErr != nil {
+		http.Error(w, "failed to archive user", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditAdminArchived, map[string]interface{}{"admin_id": admin.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func AdminRestoreUser(w http.ResponseWriter, r *http.Request) {
+	admin := middlewares.UserContext(r)
+	user, done := adminTarget(w, r)
+	if done {
+		return
+	}
+	if user.ArchivedAt == nil {
+		http.Error(w, "user is not archived", http.StatusConflict)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.RestoreUser(tx, user.ID, *user.ArchivedAt)
+	})
+	if dbHelper.IsUniqueViolation(txErr) {
+		http.Error(w, "email address is already in use by another account", http.StatusConflict)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to restore user", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditAdminRestored, map[string]interface{}{"admin_id": admin.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminLogoutUser revokes every credential of the user, personal access tokens
+// included.
+func AdminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	admin := middlewares.UserContext(r)
+	user, done := adminTarget(w, r)
+	if done {
+		return
+	}
+
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.RevokeAllUserTokens(tx, user.ID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to log out user", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditAdminLoggedOut, map[string]interface{}{"admin_id": admin.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminEraseUser hard-deletes an archived account once its grace period has
+// passed. The account's own audit trail is erased with it, so the event is
+// recorded against the admin.
+func AdminEraseUser(w http.ResponseWriter, r *http.Request) {
+	admin := middlewares.UserContext(r)
+	user, done := adminTarget(w, r)
+	if done {
+		return
+	}
+	if user.ArchivedAt == nil {
+		http.Error(w, "user is not archived", http.StatusConflict)
+		return
+	}
+	erasableAt := user.ArchivedAt.Add(config.AccountDeletionGracePeriod)
+	if time.Now().Before(erasableAt) {
+		http.Error(w, "user is still within the deletion grace period until "+erasableAt.UTC().Format(time.RFC3339), http.StatusConflict)
+		return
+	}
+
+	erased, err := maintenance.EraseArchivedUser(r.Context(), user.ID, time.Now().Add(-config.AccountDeletionGracePeriod))
+	if err != nil {
+		http.Error(w, "failed to erase user", http.StatusInternalServerError)
+		return
+	}
+	if !erased {
+		http.Error(w, "user is no longer erasable", http.StatusConflict)
+		return
+	}
+	audit(r, admin.ID, auditAdminErased, map[string]interface{}{"user_id": user.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
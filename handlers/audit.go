@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	auditRegistered         = "user.registered"
+	auditLogin              = "user.login"
+	auditLogout             = "user.logout"
+	auditPasswordChanged    = "user.password_changed"
+	auditPasswordReset      = "user.password_reset"
+	auditEmailChangeRequest = "user.email_change_requested"
+	auditEmailVerified      = "user.email_verified"
+	auditAccountArchived    = "user.account_archived"
+	auditAccountRestored    = "user.account_restored"
+	auditSessionRevoked     = "user.session_revoked"
+	auditDataExported       = "user.data_exported"
+	auditMFAEnabled         = "user.mfa_enabled"
+	auditMFADisabled        = "user.mfa_disabled"
+	auditRecoveryCodeUsed   = "user.mfa_recovery_code_used"
+	auditAccessTokenCreated = "user.access_token_created"
+	auditAccessTokenRevoked = "user.access_token_revoked"
+	auditLoginLocked        = "user.login_locked"
+	auditIdentityLinked     = "user.identity_linked"
+	auditAdminArchived      = "admin.user_archived"
+	auditAdminRestored      = "admin.user_restored"
+	auditAdminLoggedOut     = "admin.user_logged_out"
+	auditAdminErased        = "admin.user_erased"
+)
+
+// audit records the event on a best-effort basis; a failure to write the
+// audit trail never fails the request itself.
+func audit(r *http.Request, userID uuid.UUID, event string, metadata map[string]interface{}) {
+	err := dbHelper.RecordAuditEvent(database.TodoEx, userID, event, utils.ClientIP(r), r.UserAgent(), metadata)
+	if err != nil {
+		logrus.WithError(err).WithField("event", event).Error("failed to record audit event")
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportData streams a ZIP of everything stored about the caller. Once the
+// first byte is written the status can no longer change, so a failure half
+// way through is logged and leaves the client with a truncated archive.
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="todoex-export-%s.zip"`, time.Now().UTC().Format("20060102")))
+
+	zw := zip.NewWriter(w)
+	err := writeExport(zw, user)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("failed to export user data")
+		return
+	}
+	audit(r, user.ID, auditDataExported, nil)
+}
+
+func writeExport(zw *zip.Writer, user *models.User) error {
+	profile, err := zw.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(profile).Encode(user); err != nil {
+		return err
+	}
+
+	todos, err := zw.Create("todos.json")
+	if err != nil {
+		return err
+	}
+	todoArray := newJSONArrayWriter(todos)
+	if err := dbHelper.EachUserTodo(user.ID, func(task models.Todo) error {
+		return todoArray.write(task)
+	}); err != nil {
+		return err
+	}
+	if err := todoArray.close(); err != nil {
+		return err
+	}
+
+	sessions, err := dbHelper.ListAllUserSessions(user.ID)
+	if err != nil {
+		return err
+	}
+	sessionFile, err := zw.Create("sessions.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(sessionFile).Encode(sessions); err != nil {
+		return err
+	}
+
+	auditFile, err := zw.Create("audit.json")
+	if err != nil {
+		return err
+	}
+	auditArray := newJSONArrayWriter(auditFile)
+	if err := dbHelper.EachUserAuditEvent(user.ID, func(event models.AuditEvent) error {
+		return auditArray.write(event)
+	}); err != nil {
+		return err
+	}
+	return auditArray.close()
+}
+
+// jsonArrayWriter encodes a JSON array one element at a time.
+type jsonArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArrayWriter(w io.Writer) *jsonArrayWriter {
+	return &jsonArrayWriter{w: w}
+}
+
+func (a *jsonArrayWriter) write(v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if a.count == 0 {
+		separator = "["
+	}
+	a.count++
+	if _, err := io.WriteString(a.w, separator); err != nil {
+		return err
+	}
+	_, err = a.w.Write(encoded)
+	return err
+}
+
+func (a *jsonArrayWriter) close() error {
+	closing := "]\n"
+	if a.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(a.w, closing)
+	return err
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ray-remotestate/todoEx/jwtkeys"
+)
+
+// JWKS publishes the public keys access tokens are verified with, so other
+// services can check them without calling this API.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(jwtkeys.JWKS())
+}
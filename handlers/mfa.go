@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
+)
+
+const recoveryCodeCount = 10
+
+var errInvalidMFAChallenge = errors.New("invalid mfa challenge")
+
+// startMFAChallenge answers the login request with a short-lived challenge
+// token when the user has two-factor authentication enabled. It reports
+// whether it wrote a response.
+func startMFAChallenge(w http.ResponseWriter, userID uuid.UUID, method string, cookieMode bool) bool {
+	enabled, err := dbHelper.IsTOTPEnabled(userID)
+	if err != nil {
+		http.Error(w, "failed to check two-factor authentication", http.StatusInternalServerError)
+		return true
+	}
+	if !enabled {
+		return false
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to create mfa challenge", http.StatusInternalServerError)
+		return true
+	}
+	if err := dbHelper.CreateMFAChallenge(userID, utils.HashToken(token), method, cookieMode); err != nil {
+		http.Error(w, "failed to create mfa challenge", http.StatusInternalServerError)
+		return true
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int(config.MFAChallengeLifetime.Seconds()),
+	})
+	return true
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func verifySecondFactor(tx *sql.Tx, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return dbHelper.ConsumeRecoveryCode(tx, userID, utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode)))
+	}
+
+	secret, enabledAt, err := dbHelper.GetTOTPSecret(tx, userID)
+	if err != nil || secret == nil || enabledAt == nil {
+		return false, err
+	}
+	step, ok := utils.ValidateTOTP(*secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return dbHelper.UseTOTPStep(tx, userID, step)
+}
+
+// CompleteMFALogin exchanges a challenge token plus a valid code for the same
+// credentials /login or /login_JWT would have returned. A session login keeps
+// the cookie mode the original login asked for.
+func CompleteMFALogin(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.MFAToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// failed codes count against the same account and IP limits as failed
+	// passwords; otherwise fresh challenges from /login would allow unlimited
+	// guesses
+	tokenHash := utils.HashToken(body.MFAToken)
+	email, err := dbHelper.GetMFAChallengeEmail(tokenHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if loginLocked(w, r, email) {
+		return
+	}
+
+	var challenge models.MFAChallenge
+	verified := false
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		var err error
+		challenge, err = dbHelper.GetMFAChallengeForUpdate(tx, tokenHash)
+		if err == sql.ErrNoRows {
+			return errInvalidMFAChallenge
+		} else if err != nil {
+			return err
+		}
+
+		verified, err = verifySecondFactor(tx, challenge.UserID, body.Code, body.RecoveryCode)
+		if err != nil {
+			return err
+		}
+		if !verified {
+			return dbHelper.RecordMFAChallengeFailure(tx, challenge.ID)
+		}
+		return dbHelper.MarkMFAChallengeUsed(tx, challenge.ID)
+	})
+	if txErr == errInvalidMFAChallenge {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		if lockedUntil := recordLoginFailure(r, email); !lockedUntil.IsZero() {
+			writeLockout(w, lockedUntil)
+			return
+		}
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	loginSucceeded(r, email)
+
+	if body.RecoveryCode != "" {
+		audit(r, challenge.UserID, auditRecoveryCodeUsed, nil)
+	}
+	if challenge.Method == middlewares.AuthMethodJWT {
+		completeJWTLogin(w, r, challenge.UserID)
+		return
+	}
+	completeSessionLogin(w, r, challenge.UserID, challenge.CookieMode || wantsSessionCookie(r))
+}
+
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := dbHelper.IsTOTPEnabled(user.ID)
+	if err != nil {
+		http.Error(w, "failed to check two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	if err := dbHelper.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		http.Error(w, "failed to save secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(config.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP turns a pending secret on once the user proves their app
+// generates matching codes, and hands out the recovery codes. They are only
+// ever shown here; the database keeps their hashes.
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Code string `json:"code"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabledAt, err := dbHelper.GetTOTPSecret(database.TodoEx, user.ID)
+	if err != nil {
+		http.Error(w, "failed to check two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if enabledAt != nil {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == nil {
+		http.Error(w, "two-factor enrollment has not been started", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(*secret, body.Code, time.Now())
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, "failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	codeHashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		codeHashes = append(codeHashes, utils.HashToken(code))
+	}
+
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		if _, err := dbHelper.UseTOTPStep(tx, user.ID, step); err != nil {
+			return err
+		}
+		if err := dbHelper.EnableTOTP(tx, user.ID); err != nil {
+			return err
+		}
+		return dbHelper.ReplaceRecoveryCodes(tx, user.ID, codeHashes)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditMFAEnabled, nil)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !reauthenticate(w, r, user.Email, body.Password, "password is incorrect") {
+		return
+	}
+
+	verified := false
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		var err error
+		verified, err = verifySecondFactor(tx, user.ID, body.Code, body.RecoveryCode)
+		if err != nil || !verified {
+			return err
+		}
+		return dbHelper.DisableTOTP(tx, user.ID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		reauthFailed(w, r, user.Email, "invalid code")
+		return
+	}
+	audit(r, user.ID, auditMFADisabled, nil)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Two-factor authentication disabled"}`))
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/oidc"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// oidcBindingCookie ties the callback to the browser that started the login.
+// Without it anyone holding a callback URL could redeem it, or plant their
+// own login in a victim's browser.
+const oidcBindingCookie = "todoex_oidc_binding"
+
+var (
+	errIdentityArchived   = errors.New("linked account is archived")
+	errIdentityNoEmail    = errors.New("identity has no usable email")
+	errIdentityEmailTaken = errors.New("email belongs to an unlinked account")
+)
+
+// OIDCLogin starts the authorization code flow by redirecting to the identity
+// provider. The state, nonce and PKCE verifier are kept server-side until the
+// callback redeems them, along with whether ?mode=cookie was requested.
+// They are only released to the browser holding the binding cookie.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if oidc.Default == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+	binding, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := oidc.Default.AuthCodeURL(r.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		logrus.WithError(err).Error("failed to build authorization url")
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	if err := dbHelper.CreateOIDCLoginState(utils.HashToken(state), utils.HashToken(binding), codeVerifier, nonce, wantsSessionCookie(r)); err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+	setOIDCBindingCookie(w, binding, int(config.OIDCLoginStateLifetime.Seconds()))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback finishes the flow: it redeems the code, verifies the ID token,
+// resolves or provisions the local user and answers like /login does.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if oidc.Default == nil {
+		http.Error(w, "single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		http.Error(w, "login was denied by the identity provider", http.StatusUnauthorized)
+		return
+	}
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "missing state or code", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := r.Cookie(oidcBindingCookie)
+	if err != nil || binding.Value == "" {
+		http.Error(w, "login was not started in this browser", http.StatusBadRequest)
+		return
+	}
+	setOIDCBindingCookie(w, "", -1)
+
+	codeVerifier, nonce, cookieMode, err := dbHelper.ConsumeOIDCLoginState(utils.HashToken(state), utils.HashToken(binding.Value))
+	if err == sql.ErrNoRows {
+		http.Error(w, "invalid or expired login state", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	rawIDToken, err := oidc.Default.Exchange(r.Context(), code, codeVerifier)
+	if err != nil {
+		logrus.WithError(err).Warn("oidc code exchange failed")
+		http.Error(w, "failed to exchange authorization code", http.StatusBadGateway)
+		return
+	}
+	claims, err := oidc.Default.VerifyIDToken(r.Context(), rawIDToken, nonce)
+	if err != nil {
+		logrus.WithError(err).Warn("oidc id token rejected")
+		http.Error(w, "invalid id token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := resolveIdentityUser(r, claims)
+	switch {
+	case errors.Is(err, errIdentityArchived):
+		http.Error(w, "account is archived", http.StatusForbidden)
+		return
+	case errors.Is(err, errIdentityNoEmail):
+		http.Error(w, "identity provider did not return a valid email address", http.StatusBadRequest)
+		return
+	case errors.Is(err, errIdentityEmailTaken):
+		http.Error(w, "an account with this email already exists", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	if startMFAChallenge(w, userID, middlewares.AuthMethodSession, cookieMode) {
+		return
+	}
+	completeSessionLogin(w, r, userID, cookieMode)
+}
+
+// setOIDCBindingCookie uses SameSite=Lax so the cookie still comes along on the
+// identity provider's top-level redirect back to the callback.
+func setOIDCBindingCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   config.SessionCookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// resolveIdentityUser returns the user linked to the identity. An unknown
+// identity is linked to the account with the same email only when the
+// provider vouches for that email; otherwise a new user is provisioned.
+func resolveIdentityUser(r *http.Request, claims *oidc.IDTokenClaims) (uuid.UUID, error) {
+	provider := config.OIDCProviderName
+
+	userID, archived, err := dbHelper.GetUserIDByIdentity(provider, claims.Subject)
+	if err == nil {
+		if archived {
+			return uuid.Nil, errIdentityArchived
+		}
+		if err := dbHelper.TouchUserIdentity(provider, claims.Subject, claims.Email); err != nil {
+			logrus.WithError(err).Warn("failed to update identity last_login_at")
+		}
+		return userID, nil
+	} else if err != sql.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	if !utils.IsValidEmail(claims.Email) {
+		return uuid.Nil, errIdentityNoEmail
+	}
+
+	userID, err = dbHelper.GetUserIDByEmail(claims.Email)
+	if err == nil {
+		if !claims.EmailVerified {
+			return uuid.Nil, errIdentityEmailTaken
+		}
+		if err := dbHelper.CreateUserIdentity(database.TodoEx, userID, provider, claims.Subject, claims.Email); err != nil {
+			return uuid.Nil, err
+		}
+		audit(r, userID, auditIdentityLinked, map[string]interface{}{"provider": provider})
+		return userID, nil
+	} else if err != sql.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	return provisionIdentityUser(r, provider, claims)
+}
+
+// provisionIdentityUser creates an account for a first-time SSO login. It gets
+// a random password nobody knows; the user can set one through password reset.
+func provisionIdentityUser(r *http.Request, provider string, claims *oidc.IDTokenClaims) (uuid.UUID, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = claims.Email[:strings.LastIndex(claims.Email, "@")]
+	}
+
+	password, err := utils.GenerateToken()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var userID uuid.UUID
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		var err error
+		userID, err = dbHelper.CreateUser(tx, name, claims.Email, hashedPassword)
+		if err != nil {
+			return err
+		}
+		if claims.EmailVerified {
+			if err := dbHelper.MarkEmailVerified(tx, userID, claims.Email); err != nil {
+				return err
+			}
+		}
+		return dbHelper.CreateUserIdentity(tx, userID, provider, claims.Subject, claims.Email)
+	})
+	if dbHelper.IsUniqueViolation(txErr) {
+		// a concurrent callback for the same identity won the race
+		userID, archived, err := dbHelper.GetUserIDByIdentity(provider, claims.Subject)
+		if err == sql.ErrNoRows {
+			return uuid.Nil, errIdentityEmailTaken
+		} else if err != nil {
+			return uuid.Nil, err
+		}
+		if archived {
+			return uuid.Nil, errIdentityArchived
+		}
+		return userID, nil
+	} else if txErr != nil {
+		return uuid.Nil, txErr
+	}
+
+	audit(r, userID, auditRegistered, map[string]interface{}{"provider": provider})
+	if !claims.EmailVerified {
+		if err := sendEmailVerification(userID, claims.Email); err != nil {
+			logrus.WithError(err).Error("failed to send verification email")
+		}
+	}
+	return userID, nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/mailer"
+	"github.com/ray-remotestate/todoEx/passwordpolicy"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errInvalidResetToken = errors.New("invalid reset token")
+	errPasswordPolicy    = errors.New("password violates the policy")
+)
+
+// violatesPasswordPolicy answers 400 with every rule the password breaks. It
+// reports whether it wrote a response.
+func violatesPasswordPolicy(w http.ResponseWriter, field, password string, personal ...string) bool {
+	errs := passwordpolicy.Default.Check(field, password, personal...)
+	if len(errs) == 0 {
+		return false
+	}
+	writePasswordPolicyErrors(w, errs)
+	return true
+}
+
+func writePasswordPolicyErrors(w http.ResponseWriter, errs []passwordpolicy.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "password does not meet the requirements",
+		"fields": errs,
+	})
+}
+
+// ForgotPassword always answers 202 so the endpoint cannot be used to find out
+// which email addresses have an account.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Email string `json:"email"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// sending in the background keeps known and unknown emails equally fast
+	go func(email string) {
+		if err := sendPasswordReset(email); err != nil {
+			logrus.WithError(err).Error("failed to send password reset")
+		}
+	}(body.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message": "If the account exists, a password reset link has been sent"}`))
+}
+
+func sendPasswordReset(email string) error {
+	userID, err := dbHelper.GetUserIDByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := dbHelper.CreatePasswordResetToken(database.TodoEx, userID, utils.HashToken(token)); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(config.PasswordResetURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your todoEx password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your todoEx account.\n\n"+
+			"Use this link within %s to choose a new password:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", config.PasswordResetTokenLifetime, link.String()),
+	})
+}
+
+var passwordResetForm = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your todoEx password</title></head>
+<body>
+<h1>Choose a new password</h1>
+<form method="post" action="reset">
+<input type="hidden" name="token" value="{{.}}">
+<label>New password <input type="password" name="password" autocomplete="new-password" required></label>
+<button type="submit">Reset password</button>
+</form>
+</body>
+</html>
+`))
+
+// PasswordResetForm is where the reset email links to unless PASSWORD_RESET_URL
+// points at a front end. It posts the form back to ResetPassword.
+func PasswordResetForm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing reset token", http.StatusBadRequest)
+		return
+	}
+
+	writeTokenForm(w, passwordResetForm, token)
+}
+
+// writeTokenForm renders a page that posts an emailed token back. Links only
+// show the form, so mail scanners that follow them cannot redeem the token.
+func writeTokenForm(w http.ResponseWriter, form *template.Template, token string) {
+	// the token is in the URL, so keep it out of caches and Referer headers
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	form.Execute(w, token)
+}
+
+// ResetPassword takes a JSON body, or the form served by PasswordResetForm.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		body.Token = r.PostFormValue("token")
+		body.Password = r.PostFormValue("password")
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var userID uuid.UUID
+	var policyErrs []passwordpolicy.FieldError
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		var err error
+		userID, err = dbHelper.ConsumePasswordResetToken(tx, utils.HashToken(body.Token))
+		if err == sql.ErrNoRows {
+			return errInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+
+		// rolling back on a policy failure leaves the token usable for another try
+		user, err := dbHelper.GetUserByUserIDWith(tx, userID)
+		if err != nil {
+			return err
+		}
+		policyErrs = passwordpolicy.Default.Check("password", body.Password, user.Email, user.Name)
+		if len(policyErrs) > 0 {
+			return errPasswordPolicy
+		}
+
+		hashedPassword, err := utils.HashPassword(body.Password)
+		if err != nil {
+			return err
+		}
+		if err := dbHelper.UpdateUserPassword(tx, userID, hashedPassword); err != nil {
+			return err
+		}
+		return dbHelper.RevokeAllUserTokens(tx, userID)
+	})
+	if txErr == errInvalidResetToken {
+		http.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if txErr == errPasswordPolicy {
+		writePasswordPolicyErrors(w, policyErrs)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	audit(r, userID, auditPasswordReset, nil)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Password has been reset"}`))
+}
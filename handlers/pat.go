@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
+)
+
+// CreateAccessToken never hands out more than the caller holds: a token
+// created with another token gets a subset of its scopes and does not outlive
+// it. Every token expires within PERSONAL_ACCESS_TOKEN_MAX_LIFETIME.
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	principal := middlewares.PrincipalContext(r)
+	if user == nil || principal == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		http.Error(w, "name must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(body.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !middlewares.IsKnownScope(scope) {
+			http.Error(w, "unknown scope "+scope, http.StatusBadRequest)
+			return
+		}
+		if !principal.HasScope(scope) {
+			http.Error(w, "cannot grant the "+scope+" scope without holding it", http.StatusForbidden)
+			return
+		}
+	}
+
+	now := time.Now()
+	maxExpiresAt := now.Add(config.PersonalAccessTokenMaxLifetime)
+	if principal.Method == middlewares.AuthMethodPersonalAccessToken &&
+		!principal.ExpiresAt.IsZero() && principal.ExpiresAt.Before(maxExpiresAt) {
+		maxExpiresAt = principal.ExpiresAt
+	}
+	if body.ExpiresAt == nil {
+		body.ExpiresAt = &maxExpiresAt
+	} else if !body.ExpiresAt.After(now) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	} else if body.ExpiresAt.After(maxExpiresAt) {
+		http.Error(w, "expires_at must not be after "+maxExpiresAt.UTC().Format(time.RFC3339), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	token := middlewares.PersonalAccessTokenPrefix + secret
+
+	pat, err := dbHelper.CreatePersonalAccessToken(user.ID, body.Name, utils.HashToken(token), body.Scopes, body.ExpiresAt)
+	if dbHelper.IsUniqueViolation(err) {
+		http.Error(w, "a token with this name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditAccessTokenCreated, map[string]interface{}{"token_id": pat.ID, "scopes": pat.Scopes})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.PersonalAccessToken
+		Token string `json:"token"`
+	}{pat, token})
+}
+
+func ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := dbHelper.ListPersonalAccessTokens(user.ID)
+	if err != nil {
+		http.Error(w, "failed to retrieve tokens", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := dbHelper.RevokePersonalAccessToken(user.ID, tokenID)
+	if err != nil {
+		http.Error(w, "failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+	audit(r, user.ID, auditAccessTokenRevoked, map[string]interface{}{"token_id": tokenID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/models"
+)
+
+type sessionResponse struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+// currentSessionID is uuid.Nil when the request was not authenticated with an
+// opaque session token.
+func currentSessionID(principal *middlewares.Principal) uuid.UUID {
+	if principal == nil || principal.Method != middlewares.AuthMethodSession {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(principal.TokenID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := dbHelper.ListUserSessions(user.ID)
+	if err != nil {
+		http.Error(w, "failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := currentSessionID(middlewares.PrincipalContext(r))
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{
+			UserSession: session,
+			Current:     session.ID == currentID,
+		})
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := dbHelper.DeleteUserSession(user.ID, sessionID)
+	if err != nil {
+		http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	audit(r, user.ID, auditSessionRevoked, map[string]interface{}{"session_id": sessionID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	currentID := currentSessionID(middlewares.PrincipalContext(r))
+	revoked, err := dbHelper.DeleteOtherUserSessions(database.TodoEx, user.ID, currentID)
+	if err != nil {
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, auditSessionRevoked, map[string]interface{}{"revoked": revoked, "others": true})
+
+	json.NewEncoder(w).Encode(map[string]int64{
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Failed password checks are counted per account and per client IP in
+// Postgres, so every replica sees the same counters. Unknown emails are
+// counted too; otherwise lockouts would reveal which accounts exist.
+func loginThrottleKeys(r *http.Request, email string) (string, string) {
+	return "account:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + utils.ClientIP(r)
+}
+
+func writeLockout(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// loginLocked answers 429 when the account or the client is locked out and
+// reports whether it did.
+func loginLocked(w http.ResponseWriter, r *http.Request, email string) bool {
+	accountKey, ipKey := loginThrottleKeys(r, email)
+	lockedUntil, err := dbHelper.GetLoginLockout(accountKey, ipKey)
+	if err != nil {
+		logrus.WithError(err).Error("failed to check login lockout")
+		return false
+	}
+	if lockedUntil.IsZero() {
+		return false
+	}
+	writeLockout(w, lockedUntil)
+	return true
+}
+
+// loginFailed records the failure and answers either 401 or, when this
+// failure triggered a lockout, 429.
+func loginFailed(w http.ResponseWriter, r *http.Request, email string) {
+	if lockedUntil := recordLoginFailure(r, email); !lockedUntil.IsZero() {
+		writeLockout(w, lockedUntil)
+		return
+	}
+	http.Error(w, "invalid email or password", http.StatusUnauthorized)
+}
+
+// recordLoginFailure counts a failed password or second-factor check against
+// the account and the client IP. It returns when the lockout it triggered
+// ends, or the zero time.
+func recordLoginFailure(r *http.Request, email string) time.Time {
+	accountKey, ipKey := loginThrottleKeys(r, email)
+
+	accountLock, err := dbHelper.RecordLoginFailure(accountKey, config.LoginMaxFailuresPerAccount)
+	if err != nil {
+		logrus.WithError(err).Error("failed to record login failure")
+	}
+	ipLock, err := dbHelper.RecordLoginFailure(ipKey, config.LoginMaxFailuresPerIP)
+	if err != nil {
+		logrus.WithError(err).Error("failed to record login failure")
+	}
+
+	if !accountLock.IsZero() {
+		userID, err := dbHelper.GetUserIDByEmail(email)
+		if err != nil {
+			userID = uuid.Nil
+		}
+		audit(r, userID, auditLoginLocked, map[string]interface{}{
+			"scope":        "account",
+			"email":        email,
+			"locked_until": accountLock,
+		})
+	}
+	if !ipLock.IsZero() {
+		audit(r, uuid.Nil, auditLoginLocked, map[string]interface{}{
+			"scope":        "ip",
+			"locked_until": ipLock,
+		})
+	}
+
+	if ipLock.After(accountLock) {
+		return ipLock
+	}
+	return accountLock
+}
+
+// reauthenticate re-checks the password of a signed-in user before a
+// sensitive change. Failures count like failed logins, so a hijacked session
+// cannot be used to guess the password. It reports whether the password was
+// correct; otherwise it has written the response.
+func reauthenticate(w http.ResponseWriter, r *http.Request, email, password, message string) bool {
+	if loginLocked(w, r, email) {
+		return false
+	}
+	if _, err := dbHelper.GetUserIDByPassword(email, password); err != nil {
+		reauthFailed(w, r, email, message)
+		return false
+	}
+	return true
+}
+
+// reauthFailed records a failed password or second-factor re-check and
+// answers 403 with message, or 429 when it triggered a lockout.
+func reauthFailed(w http.ResponseWriter, r *http.Request, email, message string) {
+	if lockedUntil := recordLoginFailure(r, email); !lockedUntil.IsZero() {
+		writeLockout(w, lockedUntil)
+		return
+	}
+	http.Error(w, message, http.StatusForbidden)
+}
+
+// loginSucceeded clears the account's failures. With two-factor
+// authentication it must only run once the second factor has passed.
+func loginSucceeded(r *http.Request, email string) {
+	accountKey, _ := loginThrottleKeys(r, email)
+	if err := dbHelper.ClearLoginFailures(accountKey); err != nil {
+		logrus.WithError(err).Error("failed to clear login failures")
+	}
+}
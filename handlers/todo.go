@@ -1,19 +1,25 @@
 package handlers
 
 import (
-	_ "database/sql"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	_ "fmt"
+	"fmt"
 	_ "log"
 	"net/http"
-	_ "strconv"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
+	"github.com/ray-remotestate/todoEx/config"
 	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
 	"github.com/ray-remotestate/todoEx/middlewares"
 	"github.com/ray-remotestate/todoEx/models"
 )
@@ -61,6 +67,11 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if config.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		http.Error(w, "email address is not verified", http.StatusForbidden)
+		return
+	}
+
 	var task models.Todo
 	err := json.NewDecoder(r.Body).Decode(&task)
 	if err != nil {
@@ -70,14 +81,15 @@ func Create(w http.ResponseWriter, r *http.Request) {
 
 	task.ID = uuid.New()
 	task.UserID = user.ID
-	task.CreatedAt = time.Now()
+	task.CreatedAt = time.Now().UTC()
+	task.UpdatedAt = task.CreatedAt
 	task.Status = "pending"
 	task.ArchivedAt = nil
 
 	_, err = database.TodoEx.Exec(`
-		INSERT INTO todo (id, user_id, title, description, status, due_date, created_at, archived_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		task.ID, task.UserID, task.Title, task.Description, task.Status, task.DueDate, task.CreatedAt, task.ArchivedAt)
+		INSERT INTO todo (id, user_id, title, description, status, due_date, created_at, updated_at, archived_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		task.ID, task.UserID, task.Title, task.Description, task.Status, task.DueDate, task.CreatedAt, task.UpdatedAt, task.ArchivedAt)
 	if err != nil {
 		http.Error(w, "failed to insert task into todo", http.StatusInternalServerError)
 		return
@@ -87,62 +99,288 @@ func Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(task)
 }
 
-func Fetch(w http.ResponseWriter, r *http.Request) {
-	// authenticate first
-	token := r.Header.Get("Authorization")
-	token = strings.TrimPrefix(token, "Bearer ")
-
-	var userID string
-	var expiresAt time.Time
+const (
+	todoPageDefaultLimit = 50
+	todoPageMaxLimit     = 200
+)
 
-	err := database.TodoEx.QueryRow(`
-		SELECT user_id, expires_at FROM user_sessions
-		WHERE session_token = $1`, token).Scan(&userID, &expiresAt)
+type todoPage struct {
+	Todos      []models.Todo `json:"todos"`
+	NextCursor *string       `json:"next_cursor"`
+}
 
-	if err != nil || time.Now().After(expiresAt) {
+// Fetch lists the user's todos a page at a time. Filters, sort and order must
+// stay the same while following next_cursor.
+func Fetch(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	rows, err := database.TodoEx.Query(`
-		SELECT id, user_id, title, description, status, due_date, created_at, archived_at
-		FROM todo
-		WHERE user_id = $1 AND archived_at IS NULL
-		ORDER BY created_at DESC`, userID)
+	filter, err := parseTodoListFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	tasks, next, err := dbHelper.ListTodos(user.ID, filter)
 	if err != nil {
 		http.Error(w, "failed to retrieve tasks", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var tasks []models.Todo
+	page := todoPage{Todos: tasks}
+	if next != nil {
+		cursor, err := encodeTodoCursor(next)
+		if err != nil {
+			http.Error(w, "failed to create cursor", http.StatusInternalServerError)
+			return
+		}
+		page.NextCursor = &cursor
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
 
-	for rows.Next() {
-		var task models.Todo
-		err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.DueDate, &task.CreatedAt, &task.ArchivedAt)
+func parseTodoListFilter(query url.Values) (dbHelper.TodoListFilter, error) {
+	filter := dbHelper.TodoListFilter{
+		Sort:       "created_at",
+		Descending: true,
+		Limit:      todoPageDefaultLimit,
+	}
+
+	if value := query.Get("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	for param, target := range map[string]**time.Time{
+		"due_before":     &filter.DueBefore,
+		"due_after":      &filter.DueAfter,
+		"created_before": &filter.CreatedBefore,
+		"created_after":  &filter.CreatedAfter,
+	} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
 		if err != nil {
-			http.Error(w, "failed to scan task from the database", http.StatusInternalServerError)
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", param)
+		}
+		*target = &t
+	}
+
+	if value := query.Get("overdue"); value != "" {
+		overdue, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("overdue must be true or false")
+		}
+		filter.Overdue = overdue
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if !dbHelper.IsTodoSortField(value) {
+			return filter, fmt.Errorf("sort must be one of created_at, due_date or title")
+		}
+		filter.Sort = value
+		filter.Descending = value == "created_at"
+	}
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > todoPageMaxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", todoPageMaxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeTodoCursor(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+		if cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+			return filter, fmt.Errorf("cursor does not match the requested sort and order")
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func encodeTodoCursor(cursor *dbHelper.TodoCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeTodoCursor(value string) (*dbHelper.TodoCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &dbHelper.TodoCursor{}
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return nil, err
+	}
+	if !cursor.Valid() {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	return cursor, nil
+}
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+)
+
+// Search ranks the user's todos against the q parameter and returns snippets
+// with the matches wrapped in <mark>.
+func Search(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		http.Error(w, "missing search query", http.StatusBadRequest)
+		return
+	}
+
+	includeArchived := false
+	if value := query.Get("include_archived"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "include_archived must be true or false", http.StatusBadRequest)
+			return
+		}
+		includeArchived = parsed
+	}
+
+	limit := searchDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > searchMaxLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", searchMaxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
 			return
 		}
-		tasks = append(tasks, task)
+		offset = parsed
 	}
 
-	json.NewEncoder(w).Encode(tasks)
+	results, err := dbHelper.SearchTodos(user.ID, q, includeArchived, limit, offset)
+	if err != nil {
+		http.Error(w, "failed to search tasks", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
 }
 
-func Update(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	token = strings.TrimPrefix(token, "Bearer ")
+// FetchByID returns one todo with validators for conditional GET, so clients
+// polling it get a 304 until it changes.
+func FetchByID(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	task, err := dbHelper.GetUserTodo(user.ID, taskID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to retrieve task", http.StatusInternalServerError)
+		return
+	}
+
+	etag := todoETag(task)
+	lastModified := task.UpdatedAt.UTC().Truncate(time.Second)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
 
-	var userID string
-	var expiresAt time.Time
+// todoETag changes whenever the todo is written, since every write bumps
+// updated_at.
+func todoETag(task models.Todo) string {
+	h := sha256.Sum256([]byte(task.ID.String() + "|" + strconv.FormatInt(task.UpdatedAt.UnixNano(), 10)))
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
 
-	err := database.TodoEx.QueryRow(`
-		SELECT user_id, expires_at FROM user_sessions
-		WHERE session_token = $1`, token).Scan(&userID, &expiresAt)
+// notModified applies If-None-Match, falling back to If-Modified-Since only
+// when no entity tags were sent, as RFC 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.After(since)
+	}
+	return false
+}
 
-	if err != nil || time.Now().After(expiresAt) {
+func Update(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -155,7 +393,7 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var updateTask models.Todo
-	err = json.NewDecoder(r.Body).Decode(&updateTask)
+	err := json.NewDecoder(r.Body).Decode(&updateTask)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
@@ -163,9 +401,9 @@ func Update(w http.ResponseWriter, r *http.Request) {
 
 	_, err = database.TodoEx.Exec(`
 		UPDATE todo
-		SET title = $1, description = $2, status = $3, due_date = $4
-		WHERE id = $5 AND user_id = $6 AND archived_at IS NULL`,
-		updateTask.Title, updateTask.Description, updateTask.Status, updateTask.DueDate, taskID, userID)
+		SET title = $1, description = $2, status = $3, due_date = $4, updated_at = $5
+		WHERE id = $6 AND user_id = $7 AND archived_at IS NULL`,
+		updateTask.Title, updateTask.Description, updateTask.Status, updateTask.DueDate, time.Now().UTC(), taskID, user.ID)
 
 	if err != nil {
 		http.Error(w, "failed to update task in the database", http.StatusInternalServerError)
@@ -177,17 +415,8 @@ func Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func Archive(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	token = strings.TrimPrefix(token, "Bearer ")
-
-	var userID string
-	var expiresAt time.Time
-
-	err := database.TodoEx.QueryRow(`
-		SELECT user_id, expires_at FROM user_sessions
-		WHERE session_token = $1`, token).Scan(&userID, &expiresAt)
-
-	if err != nil || time.Now().After(expiresAt) {
+	user := middlewares.UserContext(r)
+	if user == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -199,11 +428,11 @@ func Archive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = database.TodoEx.Exec(`
+	_, err := database.TodoEx.Exec(`
 		UPDATE todo
-		SET archived_at = $1
+		SET archived_at = $1, updated_at = $1
 		WHERE id = $2 AND user_id = $3 AND archived_at IS NULL`,
-		time.Now(), taskID, userID)
+		time.Now().UTC(), taskID, user.ID)
 	if err != nil {
 		http.Error(w, "failed to archive task in the database", http.StatusInternalServerError)
 		return
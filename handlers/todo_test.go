@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+)
+
+func TestTodoCursorRoundTrip(t *testing.T) {
+	id := uuid.MustParse("6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b")
+	tests := []dbHelper.TodoCursor{
+		{Sort: "created_at", Key: "2026-10-18 09:30:00.123456+00", ID: id},
+		{Sort: "created_at", Descending: true, Key: "2026-10-18 11:30:00+02", ID: id},
+		{Sort: "created_at", Key: "2026-10-18 15:00:00.5+05:30", ID: id},
+		{Sort: "due_date", Key: "infinity", ID: id},
+		{Sort: "due_date", Descending: true, Key: "2026-12-31 23:59:59+00", ID: id},
+		{Sort: "title", Key: "Buy milk, eggs & \"bread\"", ID: id},
+		{Sort: "title", Key: "", ID: id},
+	}
+	for _, want := range tests {
+		value, err := encodeTodoCursor(&want)
+		if err != nil {
+			t.Errorf("encode %+v: %v", want, err)
+			continue
+		}
+		got, err := decodeTodoCursor(value)
+		if err != nil {
+			t.Errorf("decode %+v: %v", want, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("round trip = %+v, want %+v", *got, want)
+		}
+	}
+}
+
+func TestDecodeTodoCursorMalformed(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	const id = `"6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"`
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", encode(`{}`) + "=="},
+		{"not JSON", encode("created_at|2026-10-18")},
+		{"empty object", encode(`{}`)},
+		{"unknown sort", encode(`{"s":"priority","k":"1","i":` + id + `}`)},
+		{"missing ID", encode(`{"s":"title","k":"a"}`)},
+		{"nil ID", encode(`{"s":"title","k":"a","i":"00000000-0000-0000-0000-000000000000"}`)},
+		{"invalid ID", encode(`{"s":"title","k":"a","i":"42"}`)},
+		{"timestamp key not a time", encode(`{"s":"created_at","k":"yesterday","i":` + id + `}`)},
+		{"timestamp key in RFC 3339", encode(`{"s":"created_at","k":"2026-10-18T09:30:00Z","i":` + id + `}`)},
+		{"timestamp key empty", encode(`{"s":"due_date","k":"","i":` + id + `}`)},
+		{"title key with NUL", encode(`{"s":"title","k":"a\u0000b","i":` + id + `}`)},
+		{"wrong key type", encode(`{"s":"title","k":1,"i":` + id + `}`)},
+	}
+	for _, tt := range tests {
+		if cursor, err := decodeTodoCursor(tt.value); err == nil {
+			t.Errorf("%s: decoded %+v, want an error", tt.name, *cursor)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+func issueRefreshToken(exec dbHelper.SQLExecutor, userID, familyID uuid.UUID) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	return token, dbHelper.CreateRefreshToken(exec, userID, familyID, utils.HashToken(token))
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh pair. Each
+// refresh token is single-use; presenting one that was already rotated is
+// treated as theft and revokes every token descended from the same login.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var userID uuid.UUID
+	var refreshToken string
+	reused := false
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		current, err := dbHelper.GetRefreshTokenForUpdate(tx, utils.HashToken(body.RefreshToken))
+		if err == sql.ErrNoRows {
+			return errInvalidRefreshToken
+		} else if err != nil {
+			return err
+		}
+
+		if current.UsedAt != nil {
+			reused = true
+			return dbHelper.RevokeRefreshTokenFamily(tx, current.FamilyID)
+		}
+		if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		if err := dbHelper.MarkRefreshTokenUsed(tx, current.ID); err != nil {
+			return err
+		}
+		userID = current.UserID
+		refreshToken, err = issueRefreshToken(tx, current.UserID, current.FamilyID)
+		return err
+	})
+	if txErr == errInvalidRefreshToken {
+		http.Error(w, "invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	if reused {
+		logrus.Warnf("refresh token reuse detected, token family revoked")
+		http.Error(w, "invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	JWTToken, err := utils.CreateJWTToken(userID)
+	if err != nil {
+		http.Error(w, "failed to create JWT token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":         JWTToken,
+		"refresh_token": refreshToken,
+	})
+}
@@ -4,10 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"strings"
-	"time"
 
-	_ "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 	"github.com/ray-remotestate/todoEx/database"
 	"github.com/ray-remotestate/todoEx/database/dbHelper"
 	"github.com/ray-remotestate/todoEx/middlewares"
@@ -27,8 +25,12 @@ func Register_Session(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(body.Password) < 6 {
-		http.Error(w, "password must be at least 6 characters", http.StatusBadRequest)
+	if !utils.IsValidEmail(body.Email) {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	if violatesPasswordPolicy(w, "password", body.Password, body.Email, body.Name) {
 		return
 	}
 
@@ -48,13 +50,20 @@ func Register_Session(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionToken := utils.HashString(body.Email + time.Now().String())
+	sessionToken, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to create session token", http.StatusInternalServerError)
+		return
+	}
+
+	var userID uuid.UUID
 	txErr := database.Tx(func(tx *sql.Tx) error { // using *sql.Tx instead *sql.DB as we want both the operation to either commit together or fail together.
-		userID, saveErr := dbHelper.CreateUser(tx, body.Name, body.Email, hashedPassword)
+		var saveErr error
+		userID, saveErr = dbHelper.CreateUser(tx, body.Name, body.Email, hashedPassword)
 		if saveErr != nil {
 			return saveErr
 		}
-		sessionErr := dbHelper.CreateUserSession(tx, userID, sessionToken)
+		sessionErr := dbHelper.CreateUserSession(tx, userID, sessionToken, utils.ClientIP(r), r.UserAgent())
 		if sessionErr != nil {
 			return sessionErr
 		}
@@ -65,10 +74,12 @@ func Register_Session(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": sessionToken,
-	})
+	audit(r, userID, auditRegistered, nil)
+	if err := sendEmailVerification(userID, body.Email); err != nil {
+		logrus.WithError(err).Error("failed to send verification email")
+	}
+
+	writeSessionToken(w, sessionToken, wantsSessionCookie(r))
 }
 
 func Register_JWT(w http.ResponseWriter, r *http.Request) {
@@ -83,8 +94,12 @@ func Register_JWT(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(body.Password) < 6 {
-		http.Error(w, "password length must be at least 6 characters", http.StatusBadRequest)
+	if !utils.IsValidEmail(body.Email) {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	if violatesPasswordPolicy(w, "password", body.Password, body.Email, body.Name) {
 		return
 	}
 
@@ -105,9 +120,14 @@ func Register_JWT(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var userID uuid.UUID
+	var refreshToken string
 	txErr := database.Tx(func(tx *sql.Tx) error {
 		var saveErr error
 		userID, saveErr = dbHelper.CreateUser(tx, body.Name, body.Email, hashedPassword)
+		if saveErr != nil {
+			return saveErr
+		}
+		refreshToken, saveErr = issueRefreshToken(tx, userID, uuid.New())
 		return saveErr
 	})
 	if txErr != nil {
@@ -115,6 +135,11 @@ func Register_JWT(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(r, userID, auditRegistered, nil)
+	if err := sendEmailVerification(userID, body.Email); err != nil {
+		logrus.WithError(err).Error("failed to send verification email")
+	}
+
 	JWTToken, err := utils.CreateJWTToken(userID)
 	if err != nil {
 		http.Error(w, "failed to create jwt token", http.StatusInternalServerError)
@@ -123,7 +148,8 @@ func Register_JWT(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{
-		"token": JWTToken,
+		"token":         JWTToken,
+		"refresh_token": refreshToken,
 	})
 }
 
@@ -138,18 +164,56 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if loginLocked(w, r, body.Email) {
+		return
+	}
+
 	userID, err := dbHelper.GetUserIDByPassword(body.Email, body.Password)
 	if err != nil {
-		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		loginFailed(w, r, body.Email)
 		return
 	}
+	if startMFAChallenge(w, userID, middlewares.AuthMethodSession, wantsSessionCookie(r)) {
+		return
+	}
+	loginSucceeded(r, body.Email)
+	completeSessionLogin(w, r, userID, wantsSessionCookie(r))
+}
 
-	sessionToken := utils.HashString(body.Email + time.Now().String())
-	err = dbHelper.CreateUserSession(database.TodoEx, userID, sessionToken)
+func completeSessionLogin(w http.ResponseWriter, r *http.Request, userID uuid.UUID, useCookie bool) {
+	sessionToken, err := utils.GenerateToken()
+	if err != nil {
+		http.Error(w, "failed to create session token", http.StatusInternalServerError)
+		return
+	}
+
+	err = dbHelper.CreateUserSession(database.TodoEx, userID, sessionToken, utils.ClientIP(r), r.UserAgent())
 	if err != nil {
 		http.Error(w, "failed to create user session", http.StatusInternalServerError)
 		return
 	}
+	audit(r, userID, auditLogin, map[string]interface{}{"method": "session"})
+
+	writeSessionToken(w, sessionToken, useCookie)
+}
+
+// wantsSessionCookie reports whether the client asked for the session in a
+// cookie (?mode=cookie) instead of in the response body.
+func wantsSessionCookie(r *http.Request) bool {
+	return r.URL.Query().Get("mode") == "cookie"
+}
+
+// writeSessionToken answers a successful session login. In cookie mode the
+// token never reaches JavaScript; the body carries the CSRF token instead.
+func writeSessionToken(w http.ResponseWriter, sessionToken string, useCookie bool) {
+	if useCookie {
+		middlewares.SetSessionCookies(w, sessionToken)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"csrf_token": middlewares.CSRFToken(sessionToken),
+		})
+		return
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -169,52 +233,101 @@ func Login_JWT(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if loginLocked(w, r, body.Email) {
+		return
+	}
+
 	userID, err := dbHelper.GetUserIDByPassword(body.Email, body.Password)
 	if err != nil {
-		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		loginFailed(w, r, body.Email)
 		return
 	}
+	if startMFAChallenge(w, userID, middlewares.AuthMethodJWT, false) {
+		return
+	}
+	loginSucceeded(r, body.Email)
+	completeJWTLogin(w, r, userID)
+}
 
+func completeJWTLogin(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
 	JWTToken, err := utils.CreateJWTToken(userID)
 	if err != nil {
 		http.Error(w, "failed to create JWT token", http.StatusInternalServerError)
+		return
 	}
 
+	refreshToken, err := issueRefreshToken(database.TodoEx, userID, uuid.New())
+	if err != nil {
+		http.Error(w, "failed to create refresh token", http.StatusInternalServerError)
+		return
+	}
+	audit(r, userID, auditLogin, map[string]interface{}{"method": "jwt"})
+
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(`{"message":"Logged in successfully"}`))
 	json.NewEncoder(w).Encode(map[string]string{
-		"JWTtoken": JWTToken,
+		"message":       "Logged in successfully",
+		"JWTtoken":      JWTToken,
+		"refresh_token": refreshToken,
 	})
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
 	user := middlewares.UserContext(r)
-	if user == nil {
+	principal := middlewares.PrincipalContext(r)
+	if user == nil || principal == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	token := r.Header.Get("Authorization")
-	token = strings.TrimPrefix(token, "Bearer ")
-	if token == "" {
-		http.Error(w, "missing session token", http.StatusBadRequest)
+	if principal.Method == middlewares.AuthMethodJWT {
+		logoutJWT(w, r, user.ID, principal)
+		return
+	}
+	if principal.Method == middlewares.AuthMethodPersonalAccessToken {
+		http.Error(w, "personal access tokens are revoked through /api/tokens", http.StatusBadRequest)
 		return
 	}
 
-	dbUserID, err := dbHelper.GetUserIDBySession(token)
-	if err != nil || dbUserID != user.ID {
+	deleted, err := dbHelper.DeleteUserSession(user.ID, currentSessionID(principal))
+	if err != nil {
+		http.Error(w, "failed to logout", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
 		http.Error(w, "invalid session token", http.StatusUnauthorized)
 		return
 	}
+	if principal.ViaCookie {
+		middlewares.ClearSessionCookies(w)
+	}
+	audit(r, user.ID, auditLogout, map[string]interface{}{"method": "session"})
 
-	_, err = database.TodoEx.Exec(`
-		DELETE FROM user_sessions
-		WHERE session_token = $1`, token)
-	if err != nil {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Logged out successfully"}`))
+}
+
+// logoutJWT denylists the presented access token and, when the client sends
+// its refresh token along, revokes that token's whole family too.
+func logoutJWT(w http.ResponseWriter, r *http.Request, userID uuid.UUID, principal *middlewares.Principal) {
+	body := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	_ = json.NewDecoder(r.Body).Decode(&body) // the body is optional
+
+	if err := dbHelper.RevokeToken(principal.TokenID, userID, principal.ExpiresAt); err != nil {
 		http.Error(w, "failed to logout", http.StatusInternalServerError)
 		return
 	}
 
+	if body.RefreshToken != "" {
+		err := dbHelper.RevokeRefreshTokenFamilyByToken(database.TodoEx, userID, utils.HashToken(body.RefreshToken))
+		if err != nil {
+			http.Error(w, "failed to logout", http.StatusInternalServerError)
+			return
+		}
+	}
+	audit(r, userID, auditLogout, map[string]interface{}{"method": "jwt"})
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Logged out successfully"}`))
 }
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/mailer"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/ray-remotestate/todoEx/utils"
+)
+
+var errInvalidVerificationToken = errors.New("invalid verification token")
+
+func sendEmailVerification(userID uuid.UUID, email string) error {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		return dbHelper.CreateEmailVerificationToken(tx, userID, email, utils.HashToken(token))
+	})
+	if txErr != nil {
+		return txErr
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppBaseURL, url.QueryEscape(token))
+	return mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your todoEx email address",
+		Body: fmt.Sprintf("Please confirm that this address belongs to your todoEx account by opening this link within %s:\n%s",
+			config.EmailVerificationTokenLifetime, link),
+	})
+}
+
+var verifyEmailForm = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm your todoEx email address</title></head>
+<body>
+<h1>Confirm your email address</h1>
+<form method="post" action="verify-email">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Confirm</button>
+</form>
+</body>
+</html>
+`))
+
+// VerifyEmailForm is where the verification email links to. Opening the link
+// does not use up the token; submitting the form does.
+func VerifyEmailForm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing verification token", http.StatusBadRequest)
+		return
+	}
+	writeTokenForm(w, verifyEmailForm, token)
+}
+
+// VerifyEmail takes the token as a JSON body, or from the form served by
+// VerifyEmailForm.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var token string
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		token = r.PostFormValue("token")
+	} else {
+		body := struct {
+			Token string `json:"token"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		token = body.Token
+	}
+	if token == "" {
+		http.Error(w, "missing verification token", http.StatusBadRequest)
+		return
+	}
+
+	var userID uuid.UUID
+	var email string
+	txErr := database.Tx(func(tx *sql.Tx) error {
+		var err error
+		userID, email, err = dbHelper.ConsumeEmailVerificationToken(tx, utils.HashToken(token))
+		if err == sql.ErrNoRows {
+			return errInvalidVerificationToken
+		} else if err != nil {
+			return err
+		}
+		return dbHelper.MarkEmailVerified(tx, userID, email)
+	})
+	if txErr == errInvalidVerificationToken {
+		http.Error(w, "invalid or expired verification token", http.StatusBadRequest)
+		return
+	} else if dbHelper.IsUniqueViolation(txErr) {
+		http.Error(w, "email address is already in use", http.StatusConflict)
+		return
+	} else if txErr != nil {
+		http.Error(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	audit(r, userID, auditEmailVerified, map[string]interface{}{"email": email})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Email address verified"}`))
+}
+
+func ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.UserContext(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "email address is already verified", http.StatusBadRequest)
+		return
+	}
+
+	if err := sendEmailVerification(user.ID, user.Email); err != nil {
+		http.Error(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message": "Verification email sent"}`))
+}
@@ -0,0 +1,232 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Key is one JWT key. Public keys of previous signing keys have no private
+// half and are only used to verify tokens issued before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+func (k *Key) SigningKey() interface{} {
+	return k.private
+}
+
+func (k *Key) VerificationKey() interface{} {
+	return k.public
+}
+
+func (k *Key) symmetric() bool {
+	_, ok := k.public.([]byte)
+	return ok
+}
+
+var (
+	signing *Key
+	keys    = map[string]*Key{}
+)
+
+// Init must run before any token is issued or verified. It loads the signing
+// key from JWT_SIGNING_KEY_FILE, or falls back to HS256 with JWT_SECRET_KEY,
+// and adds every JWT_VERIFICATION_KEY_FILES key to the verification set.
+func Init() {
+	// iat in whole seconds cannot tell a token issued just before a user-wide
+	// revocation from one issued just after it
+	jwt.TimePrecision = time.Microsecond
+
+	if config.JWTSigningKeyFile == "" {
+		signing = hmacKey(config.SecretKey)
+	} else {
+		key, err := loadPEMKey(config.JWTSigningKeyFile)
+		if err != nil {
+			logrus.Fatalf("failed to load JWT signing key: %v", err)
+		}
+		if !key.CanSign() {
+			logrus.Fatalf("JWT signing key %s holds no private key", config.JWTSigningKeyFile)
+		}
+		signing = key
+	}
+	keys = map[string]*Key{signing.ID: signing}
+
+	for _, path := range config.JWTVerificationKeyFiles {
+		key, err := loadPEMKey(path)
+		if err != nil {
+			logrus.Fatalf("failed to load JWT verification key: %v", err)
+		}
+		keys[key.ID] = key
+	}
+	if config.JWTAcceptHS256 && !signing.symmetric() {
+		legacy := hmacKey(config.SecretKey)
+		keys[legacy.ID] = legacy
+	}
+}
+
+// Signing returns the key new tokens are signed with.
+func Signing() *Key {
+	return signing
+}
+
+// Lookup finds a verification key by kid. Tokens issued before key ids were
+// introduced carry none; they were HS256 and match the secret key if it is
+// still accepted.
+func Lookup(kid string) (*Key, bool) {
+	if kid == "" {
+		kid = hmacKey(config.SecretKey).ID
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// Methods lists the algorithms of every verification key.
+func Methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+func hmacKey(secret []byte) *Key {
+	h := sha256.Sum256(append([]byte("kid:"), secret...))
+	return &Key{
+		ID:      "hs256-" + base64.RawURLEncoding.EncodeToString(h[:8]),
+		Method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS publishes the public half of every asymmetric key; HMAC secrets are
+// never included.
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range keys {
+		if jwk, ok := publicJWK(key.public); ok {
+			jwk.Kid = key.ID
+			jwk.Use = "sig"
+			jwk.Alg = key.Method.Alg()
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	// current key first, the rest in a stable order
+	sort.Slice(set.Keys, func(i, j int) bool {
+		a, b := set.Keys[i].Kid, set.Keys[j].Kid
+		if a == signing.ID || b == signing.ID {
+			return a == signing.ID
+		}
+		return a < b
+	})
+	return set
+}
+
+func publicJWK(public interface{}) (JSONWebKey, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{Kty: "RSA", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, true
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   encode(key.X.FillBytes(make([]byte, size))),
+			Y:   encode(key.Y.FillBytes(make([]byte, size))),
+		}, true
+	case ed25519.PublicKey:
+		return JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: encode(key)}, true
+	}
+	return JSONWebKey{}, false
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint, used as the kid so the same key
+// always gets the same id without any configuration.
+func thumbprint(public interface{}) string {
+	jwk, _ := publicJWK(public)
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, _ := json.Marshal(members)
+	h := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// methodFor picks the algorithm matching the key type.
+func methodFor(public interface{}) (jwt.SigningMethod, bool) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, true
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, true
+		case elliptic.P384():
+			return jwt.SigningMethodES384, true
+		case elliptic.P521():
+			return jwt.SigningMethodES512, true
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, true
+	}
+	return nil, false
+}
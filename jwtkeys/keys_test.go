@@ -0,0 +1,105 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func decodeB64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name   string
+		public func(t *testing.T) interface{}
+		want   string
+	}{
+		{
+			// RFC 7638 section 3.1
+			name: "RSA",
+			public: func(t *testing.T) interface{} {
+				n := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+				return &rsa.PublicKey{N: new(big.Int).SetBytes(decodeB64(t, n)), E: 65537}
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037 appendix A.3
+			name: "Ed25519",
+			public: func(t *testing.T) interface{} {
+				return ed25519.PublicKey(decodeB64(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"))
+			},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+	for _, tt := range tests {
+		if got := thumbprint(tt.public(t)); got != tt.want {
+			t.Errorf("%s: thumbprint = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublicJWKPadsECCoordinates(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A coordinate with leading zero bytes must still encode to 32 bytes.
+	key.PublicKey.X = big.NewInt(1)
+
+	jwk, ok := publicJWK(&key.PublicKey)
+	if !ok {
+		t.Fatal("publicJWK rejected an ECDSA key")
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" {
+		t.Errorf("kty, crv = %q, %q, want EC, P-256", jwk.Kty, jwk.Crv)
+	}
+	if n := len(decodeB64(t, jwk.X)); n != 32 {
+		t.Errorf("x is %d bytes, want 32", n)
+	}
+}
+
+func TestMethodFor(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name   string
+		public interface{}
+		want   jwt.SigningMethod
+	}{
+		{"RSA", &rsaKey.PublicKey, jwt.SigningMethodRS256},
+		{"P-256", &p256.PublicKey, jwt.SigningMethodES256},
+		{"P-384", &p384.PublicKey, jwt.SigningMethodES384},
+		{"Ed25519", edPublic, jwt.SigningMethodEdDSA},
+	}
+	for _, tt := range tests {
+		got, ok := methodFor(tt.public)
+		if !ok || got != tt.want {
+			t.Errorf("%s: methodFor = %v, %v, want %v", tt.name, got, ok, tt.want.Alg())
+		}
+	}
+
+	if _, ok := methodFor("not a key"); ok {
+		t.Error("methodFor accepted an unsupported key type")
+	}
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ray-remotestate/todoEx/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Default is the sender used by Send; Init picks it from MAIL_DRIVER.
+var Default Sender = LogSender{}
+
+func Init() {
+	switch config.MailDriver {
+	case "log":
+		Default = LogSender{}
+	case "file":
+		Default = FileSender{Path: config.MailFilePath}
+	case "smtp":
+		Default = SMTPSender{
+			Addr:     config.SMTPAddr,
+			From:     config.MailFrom,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+		}
+	default:
+		log.Fatalf("unknown MAIL_DRIVER %q", config.MailDriver)
+	}
+}
+
+func Send(msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("mail header contains a line break")
+	}
+	if err := Default.Send(msg); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
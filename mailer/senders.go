@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogSender only records that a message would have been sent. The body is left
+// out because it carries live reset and verification tokens; use FileSender
+// to read the messages themselves.
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	logrus.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info("mail not delivered: MAIL_DRIVER is log")
+	return nil
+}
+
+var fileSenderMu sync.Mutex
+
+// FileSender appends every message to a local file, which is handy in
+// development when no mail server is running.
+type FileSender struct {
+	Path string
+}
+
+func (s FileSender) Send(msg Message) error {
+	fileSenderMu.Lock()
+	defer fileSenderMu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n\r\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// SMTPSender delivers over plain SMTP, e.g. to MailHog on localhost:1025.
+// Authentication is only attempted when a username is configured.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := strings.Split(s.Addr, ":")[0]
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.From, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body))
+}
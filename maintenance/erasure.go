@@ -0,0 +1,71 @@
+package maintenance
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/sirupsen/logrus"
+)
+
+var erasedUsers = expvar.NewInt("maintenance_erased_users")
+
+// EraseArchivedUsers permanently deletes accounts archived before
+// archivedBefore. Todos, sessions, tokens and audit entries go with them
+// through the ON DELETE CASCADE foreign keys.
+func EraseArchivedUsers(ctx context.Context, archivedBefore time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	var total int64
+	for {
+		result, err := database.TodoEx.ExecContext(ctx, `
+			DELETE FROM users WHERE id IN (
+				SELECT id FROM users
+				WHERE archived_at IS NOT NULL AND archived_at <= $1
+				LIMIT $2
+			)`, archivedBefore, batchSize)
+		if err != nil {
+			return total, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+		erasedUsers.Add(affected)
+		if affected < int64(batchSize) {
+			logrus.Infof("maintenance: erased %d archived users", total)
+			return total, nil
+		}
+	}
+}
+
+// EraseArchivedUser permanently deletes a single account if it was archived
+// before archivedBefore, and reports whether it did.
+func EraseArchivedUser(ctx context.Context, userID uuid.UUID, archivedBefore time.Time) (bool, error) {
+	result, err := database.TodoEx.ExecContext(ctx, `
+		DELETE FROM users
+		WHERE id = $1 AND archived_at IS NOT NULL AND archived_at <= $2`, userID, archivedBefore)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	erasedUsers.Add(affected)
+	return affected > 0, nil
+}
+
+func CountErasableUsers(ctx context.Context, archivedBefore time.Time) (int64, error) {
+	var count int64
+	err := database.TodoEx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM users
+		WHERE archived_at IS NOT NULL AND archived_at <= $1`, archivedBefore).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,214 @@
+package maintenance
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/ray-remotestate/todoEx/database"
+	"github.com/ray-remotestate/todoEx/middlewares"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	purgedRows = expvar.NewMap("maintenance_purged_rows")
+	runs       = expvar.NewInt("maintenance_runs")
+	failures   = expvar.NewInt("maintenance_failures")
+)
+
+// purgeTask deletes at most $1 rows per execution; the reaper keeps running it
+// until a batch comes back short. args supplies any further parameters.
+type purgeTask struct {
+	name  string
+	query string
+	args  func() []interface{}
+}
+
+var tasks = []purgeTask{
+	{
+		name: "user_sessions",
+		query: `
+			DELETE FROM user_sessions WHERE id IN (
+				SELECT id FROM user_sessions
+				WHERE expires_at <= NOW() OR last_seen_at <= $2
+				LIMIT $1
+			)`,
+		args: func() []interface{} {
+			return []interface{}{time.Now().Add(-config.SessionIdleTimeout)}
+		},
+	},
+	{
+		name: "revoked_tokens",
+		query: `
+			DELETE FROM revoked_tokens WHERE jti IN (
+				SELECT jti FROM revoked_tokens
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		name: "refresh_tokens",
+		query: `
+			DELETE FROM refresh_tokens WHERE id IN (
+				SELECT id FROM refresh_tokens
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		name: "password_reset_tokens",
+		query: `
+			DELETE FROM password_reset_tokens WHERE id IN (
+				SELECT id FROM password_reset_tokens
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		name: "email_verification_tokens",
+		query: `
+			DELETE FROM email_verification_tokens WHERE id IN (
+				SELECT id FROM email_verification_tokens
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		name: "mfa_challenges",
+		query: `
+			DELETE FROM mfa_challenges WHERE id IN (
+				SELECT id FROM mfa_challenges
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		name: "login_attempts",
+		query: `
+			DELETE FROM login_attempts WHERE key IN (
+				SELECT key FROM login_attempts
+				WHERE last_failure_at <= $2 AND (locked_until IS NULL OR locked_until <= NOW())
+				LIMIT $1
+			)`,
+		args: func() []interface{} {
+			return []interface{}{time.Now().Add(-config.LoginFailureWindow)}
+		},
+	},
+	{
+		name: "oidc_login_states",
+		query: `
+			DELETE FROM oidc_login_states WHERE state_hash IN (
+				SELECT state_hash FROM oidc_login_states
+				WHERE expires_at <= NOW()
+				LIMIT $1
+			)`,
+	},
+	{
+		// buckets idle as long as the slowest one takes to refill are full,
+		// so dropping them changes nothing for the caller
+		name: "rate_limit_buckets",
+		query: `
+			DELETE FROM rate_limit_buckets WHERE key IN (
+				SELECT key FROM rate_limit_buckets
+				WHERE updated_at <= $2
+				LIMIT $1
+			)`,
+		args: func() []interface{} {
+			return []interface{}{time.Now().Add(-rateLimitRefillTime())}
+		},
+	},
+}
+
+func rateLimitRefillTime() time.Duration {
+	public := middlewares.RateLimit{PerMinute: config.RateLimitPublicPerMinute, Burst: config.RateLimitPublicBurst}
+	api := middlewares.RateLimit{PerMinute: config.RateLimitAPIPerMinute, Burst: config.RateLimitAPIBurst}
+	if public.RefillTime() > api.RefillTime() {
+		return public.RefillTime()
+	}
+	return api.RefillTime()
+}
+
+type Reaper struct {
+	interval  time.Duration
+	batchSize int
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// Start launches the reaper in the background. It runs once immediately and
+// then every interval until Stop is called.
+func Start(interval time.Duration, batchSize int) *Reaper {
+	ctx, cancel := context.WithCancel(context.Background())
+	reaper := &Reaper{
+		interval:  interval,
+		batchSize: batchSize,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go reaper.loop(ctx)
+	return reaper
+}
+
+// Stop cancels any purge in flight and waits for the worker to exit.
+func (reaper *Reaper) Stop() {
+	reaper.cancel()
+	<-reaper.done
+}
+
+func (reaper *Reaper) loop(ctx context.Context) {
+	defer close(reaper.done)
+
+	ticker := time.NewTicker(reaper.interval)
+	defer ticker.Stop()
+
+	for {
+		reaper.run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (reaper *Reaper) run(ctx context.Context) {
+	runs.Add(1)
+	for _, task := range tasks {
+		removed, err := reaper.purge(ctx, task)
+		if removed > 0 {
+			purgedRows.Add(task.name, removed)
+			logrus.WithField("table", task.name).Infof("maintenance: purged %d rows", removed)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures.Add(1)
+			logrus.WithError(err).WithField("table", task.name).Error("maintenance: purge failed")
+		}
+	}
+}
+
+func (reaper *Reaper) purge(ctx context.Context, task purgeTask) (int64, error) {
+	args := []interface{}{reaper.batchSize}
+	if task.args != nil {
+		args = append(args, task.args()...)
+	}
+
+	var total int64
+	for {
+		result, err := database.TodoEx.ExecContext(ctx, task.query, args...)
+		if err != nil {
+			return total, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+		if affected < int64(reaper.batchSize) {
+			return total, nil
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/ray-remotestate/todoEx/config"
 	"github.com/ray-remotestate/todoEx/database/dbHelper"
 	"github.com/ray-remotestate/todoEx/models"
 	"github.com/sirupsen/logrus"
@@ -14,7 +15,8 @@ import (
 type ContextKeys string
 
 const (
-	userContext ContextKeys = "__userContext"
+	userContext      ContextKeys = "__userContext"
+	principalContext ContextKeys = "__principalContext"
 )
 
 func UserContext(r *http.Request) *models.User {
@@ -24,25 +26,47 @@ func UserContext(r *http.Request) *models.User {
 	return nil
 }
 
+func PrincipalContext(r *http.Request) *Principal {
+	if principal, ok := r.Context().Value(principalContext).(*Principal); ok && principal != nil {
+		return principal
+	}
+	return nil
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal *Principal
+		var err error
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		if authHeader != "" {
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "missing or invalid Authorization header", http.StatusUnauthorized)
+				return
+			}
+			// Resolve the user from a JWT or a session token
+			principal, err = authenticate(strings.TrimPrefix(authHeader, "Bearer "))
+		} else if cookie, cookieErr := r.Cookie(config.SessionCookieName); cookieErr == nil && cookie.Value != "" {
+			// browsers send cookies on cross-site requests too, hence the CSRF check
+			if !isSafeMethod(r.Method) && !validCSRF(r, cookie.Value) {
+				http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			principal, err = SessionAuthenticator(cookie.Value)
+			if err == nil {
+				principal.ViaCookie = true
+			}
+		} else {
 			http.Error(w, "missing or invalid Authorization header", http.StatusUnauthorized)
 			return
 		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Get user_id from session token
-		userID, err := dbHelper.GetUserIDBySession(token)
 		if err != nil {
 			logrus.Printf("%v", err)
-			http.Error(w, "invalid or expired session token", http.StatusUnauthorized)
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
 		// Get user details
-		user, err := dbHelper.GetUserByUserID(userID)
+		user, err := dbHelper.GetUserByUserID(principal.UserID)
 		if err == sql.ErrNoRows {
 			http.Error(w, "user does not exist", http.StatusNotFound)
 			return
@@ -51,8 +75,14 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if principal.RevokedBy(&user) {
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
 		// Add user to request context
 		ctx := context.WithValue(r.Context(), userContext, &user)
+		ctx = context.WithValue(ctx, principalContext, principal)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
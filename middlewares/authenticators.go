@@ -0,0 +1,164 @@
+package middlewares
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ray-remotestate/todoEx/database/dbHelper"
+	"github.com/ray-remotestate/todoEx/models"
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuthMethodSession             = "session"
+	AuthMethodJWT                 = "jwt"
+	AuthMethodPersonalAccessToken = "personal_access_token"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from session tokens without a database lookup.
+const PersonalAccessTokenPrefix = "tdx_"
+
+// ErrUnsupportedToken is returned by an Authenticator when the bearer value is
+// not a kind of token it handles, so the next one in the chain gets a chance.
+var ErrUnsupportedToken = errors.New("unsupported token")
+
+// Principal describes who made the request and which credential they used.
+type Principal struct {
+	UserID    uuid.UUID
+	Method    string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Scopes is nil for interactive logins, which may do anything.
+	Scopes []string
+	// ViaCookie is set when the session token came from the session cookie
+	// rather than the Authorization header.
+	ViaCookie bool
+}
+
+// RevokedBy reports whether a user-wide revocation happened after this
+// credential was issued. JWT timestamps carry microseconds like Postgres
+// does, and a token issued at the very instant of the revocation counts as
+// revoked.
+func (p *Principal) RevokedBy(user *models.User) bool {
+	if p.Method != AuthMethodJWT || user.TokensRevokedAt == nil {
+		return false
+	}
+	return !p.IssuedAt.After(*user.TokensRevokedAt)
+}
+
+type Authenticator interface {
+	Authenticate(token string) (*Principal, error)
+}
+
+type AuthenticatorFunc func(token string) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(token string) (*Principal, error) {
+	return f(token)
+}
+
+// Authenticators is the chain AuthMiddleware walks for every bearer token.
+var Authenticators = []Authenticator{
+	AuthenticatorFunc(PersonalAccessTokenAuthenticator),
+	AuthenticatorFunc(JWTAuthenticator),
+	AuthenticatorFunc(SessionAuthenticator),
+}
+
+func authenticate(token string) (*Principal, error) {
+	for _, authenticator := range Authenticators {
+		principal, err := authenticator.Authenticate(token)
+		if errors.Is(err, ErrUnsupportedToken) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrUnsupportedToken
+}
+
+func JWTAuthenticator(token string) (*Principal, error) {
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrUnsupportedToken
+	}
+
+	claims, err := utils.VerifyJWTToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, errors.New("token has no jti or iat claim")
+	}
+
+	revoked, err := dbHelper.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:    userID,
+		Method:    AuthMethodJWT,
+		TokenID:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func SessionAuthenticator(token string) (*Principal, error) {
+	session, err := dbHelper.GetUserSessionByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbHelper.TouchUserSession(session); err != nil {
+		logrus.WithError(err).Warn("failed to update session last_seen_at")
+	}
+
+	return &Principal{
+		UserID:    session.UserID,
+		Method:    AuthMethodSession,
+		TokenID:   session.ID.String(),
+		IssuedAt:  session.CreatedAt,
+		ExpiresAt: dbHelper.SessionExpiry(session),
+	}, nil
+}
+
+func PersonalAccessTokenAuthenticator(token string) (*Principal, error) {
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return nil, ErrUnsupportedToken
+	}
+
+	pat, err := dbHelper.GetPersonalAccessTokenByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbHelper.TouchPersonalAccessToken(pat); err != nil {
+		logrus.WithError(err).Warn("failed to update personal access token last_used_at")
+	}
+
+	principal := &Principal{
+		UserID:   pat.UserID,
+		Method:   AuthMethodPersonalAccessToken,
+		TokenID:  pat.ID.String(),
+		IssuedAt: pat.CreatedAt,
+		Scopes:   pat.Scopes,
+	}
+	if pat.ExpiresAt != nil {
+		principal.ExpiresAt = *pat.ExpiresAt
+	}
+	if principal.Scopes == nil {
+		principal.Scopes = []string{}
+	}
+	return principal, nil
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ray-remotestate/todoEx/config"
+)
+
+func TestValidCSRF(t *testing.T) {
+	oldSecret, oldName := config.SecretKey, config.CSRFCookieName
+	defer func() { config.SecretKey, config.CSRFCookieName = oldSecret, oldName }()
+	config.SecretKey, config.CSRFCookieName = []byte("test-secret"), "todoex_csrf"
+
+	const session = "session-token"
+	token := CSRFToken(session)
+	other := CSRFToken("another-session")
+
+	tests := []struct {
+		name   string
+		header string
+		cookie *string
+		want   bool
+	}{
+		{"header matches cookie and session", token, &token, true},
+		{"missing header", "", &token, false},
+		{"missing cookie", token, nil, false},
+		{"header differs from cookie", token, &other, false},
+		{"cookie differs from header", other, &token, false},
+		{"both from another session", other, &other, false},
+		{"truncated header", token[:len(token)-1], &token, false},
+		{"empty cookie", token, new(string), false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+		if tt.header != "" {
+			r.Header.Set(CSRFHeader, tt.header)
+		}
+		if tt.cookie != nil {
+			r.AddCookie(&http.Cookie{Name: config.CSRFCookieName, Value: *tt.cookie})
+		}
+		if got := validCSRF(r, session); got != tt.want {
+			t.Errorf("%s: validCSRF = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSRFTokenDependsOnSecret(t *testing.T) {
+	oldSecret := config.SecretKey
+	defer func() { config.SecretKey = oldSecret }()
+
+	config.SecretKey = []byte("first-secret")
+	first := CSRFToken("session-token")
+	if CSRFToken("session-token") != first {
+		t.Fatal("CSRFToken is not deterministic")
+	}
+	config.SecretKey = []byte("second-secret")
+	if CSRFToken("session-token") == first {
+		t.Error("CSRFToken does not depend on the secret key")
+	}
+}
@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ray-remotestate/todoEx/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimit describes a token bucket: Burst requests may be made at once and
+// the bucket refills at PerMinute requests per minute.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+func (l RateLimit) perSecond() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// RefillTime is how long an empty bucket takes to fill up again.
+func (l RateLimit) RefillTime() time.Duration {
+	return l.untilFull(0)
+}
+
+// untilFull is how long an empty-by-remaining bucket needs to refill.
+func (l RateLimit) untilFull(remaining float64) time.Duration {
+	missing := float64(l.Burst) - remaining
+	if missing <= 0 || l.PerMinute <= 0 {
+		return 0
+	}
+	return time.Duration(missing / l.perSecond() * float64(time.Second))
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  float64
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type RateLimitStore interface {
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+func NewRateLimitStore(backend string) RateLimitStore {
+	switch backend {
+	case "postgres":
+		return &PostgresRateLimitStore{}
+	case "memory":
+		return NewMemoryRateLimitStore()
+	default:
+		logrus.Fatalf("unknown RATE_LIMIT_BACKEND %q", backend)
+		return nil
+	}
+}
+
+// RateLimitMiddleware throttles each caller within group separately. Callers
+// are identified by user ID once AuthMiddleware has run and by client IP
+// otherwise. If the store fails the request is let through.
+func RateLimitMiddleware(store RateLimitStore, group string, limit RateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := group + ":ip:" + utils.ClientIP(r)
+			if principal := PrincipalContext(r); principal != nil {
+				key = group + ":user:" + principal.UserID.String()
+			}
+
+			result, err := store.Take(key, limit)
+			if err != nil {
+				logrus.WithError(err).Error("rate limiter unavailable")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(result.Remaining))))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// retryAfter is how long until a bucket holding remaining tokens has one.
+func retryAfter(limit RateLimit, remaining float64) time.Duration {
+	if remaining >= 1 || limit.PerMinute <= 0 {
+		return 0
+	}
+	return time.Duration((1 - remaining) / limit.perSecond() * float64(time.Second))
+}
@@ -0,0 +1,127 @@
+package middlewares
+
+import (
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ray-remotestate/todoEx/database"
+)
+
+const memoryPruneInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in process, so each replica enforces
+// its own limit. Buckets that have refilled completely are pruned.
+type MemoryRateLimitStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	limits   map[string]RateLimit
+	prunedAt time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:  map[string]*bucket{},
+		limits:   map[string]RateLimit{},
+		prunedAt: time.Now(),
+	}
+}
+
+func refill(b *bucket, limit RateLimit, now time.Time) float64 {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	return math.Min(float64(limit.Burst), b.tokens+elapsed*limit.perSecond())
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.prunedAt) > memoryPruneInterval {
+		s.prune(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		s.buckets[key] = b
+		s.limits[key] = limit
+	}
+
+	b.tokens = refill(b, limit, now)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return RateLimitResult{
+		Allowed:    allowed,
+		Remaining:  b.tokens,
+		Reset:      limit.untilFull(b.tokens),
+		RetryAfter: retryAfter(limit, b.tokens),
+	}, nil
+}
+
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if limit := s.limits[key]; refill(b, limit, now) >= float64(limit.Burst) {
+			delete(s.buckets, key)
+			delete(s.limits, key)
+		}
+	}
+	s.prunedAt = now
+}
+
+// PostgresRateLimitStore shares buckets between replicas. The refill and the
+// take happen in one statement on a locked row using the database clock, so
+// concurrent requests on different instances cannot overspend a bucket.
+type PostgresRateLimitStore struct{}
+
+func (s *PostgresRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	var tokens float64
+	var allowed bool
+	for attempt := 0; attempt < 2; attempt++ {
+		err := database.TodoEx.QueryRow(`
+			WITH refilled AS (
+				SELECT key, LEAST($2::float8, tokens + EXTRACT(EPOCH FROM (NOW() - updated_at)) * $3::float8) AS tokens
+				FROM rate_limit_buckets
+				WHERE key = $1
+				FOR UPDATE
+			)
+			UPDATE rate_limit_buckets b
+			SET tokens = r.tokens - CASE WHEN r.tokens >= 1 THEN 1 ELSE 0 END,
+				updated_at = NOW()
+			FROM refilled r
+			WHERE b.key = r.key
+			RETURNING b.tokens, r.tokens >= 1`, key, limit.Burst, limit.perSecond()).Scan(&tokens, &allowed)
+		if err == nil {
+			return RateLimitResult{
+				Allowed:    allowed,
+				Remaining:  tokens,
+				Reset:      limit.untilFull(tokens),
+				RetryAfter: retryAfter(limit, tokens),
+			}, nil
+		}
+		if err != sql.ErrNoRows {
+			return RateLimitResult{}, err
+		}
+
+		// first request for this key: create a full bucket and take from it
+		_, err = database.TodoEx.Exec(`
+			INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+			VALUES ($1, $2, NOW())
+			ON CONFLICT (key) DO NOTHING`, key, limit.Burst)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+	}
+	return RateLimitResult{}, sql.ErrNoRows
+}
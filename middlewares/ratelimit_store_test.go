@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	limit := RateLimit{PerMinute: 60, Burst: 10}
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 3, 0, 3},
+		{"one token per second", 3, 2 * time.Second, 5},
+		{"partial token", 0, 500 * time.Millisecond, 0.5},
+		{"capped at burst", 9, time.Minute, 10},
+	}
+	for _, tt := range tests {
+		b := &bucket{tokens: tt.tokens, updatedAt: start}
+		if got := refill(b, limit, start.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("%s: refill = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitRefillTime(t *testing.T) {
+	tests := []struct {
+		limit RateLimit
+		want  time.Duration
+	}{
+		{RateLimit{PerMinute: 60, Burst: 10}, 10 * time.Second},
+		{RateLimit{PerMinute: 30, Burst: 30}, time.Minute},
+		{RateLimit{PerMinute: 0, Burst: 10}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.RefillTime(); got != tt.want {
+			t.Errorf("%+v: RefillTime = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{PerMinute: 1, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		result, err := store.Take("ip:203.0.113.7", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: allowed = %v, err = %v", i+1, result.Allowed, err)
+		}
+	}
+
+	result, err := store.Take("ip:203.0.113.7", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Error("request past the burst was allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want within one refill interval", result.RetryAfter)
+	}
+
+	if result, _ := store.Take("ip:198.51.100.1", limit); !result.Allowed {
+		t.Error("a different key shared the exhausted bucket")
+	}
+}
@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"net/http"
+)
+
+const (
+	ScopeTodosRead    = "todos:read"
+	ScopeTodosWrite   = "todos:write"
+	ScopeAccountAdmin = "account:admin"
+	// ScopeUsersAdmin only has an effect for accounts with the admin role.
+	ScopeUsersAdmin = "users:admin"
+)
+
+var KnownScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAccountAdmin, ScopeUsersAdmin}
+
+func IsKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope must run after AuthMiddleware. Session and JWT logins pass
+// every check; personal access tokens need the scope to have been granted.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := PrincipalContext(r)
+			if principal == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !principal.HasScope(scope) {
+				http.Error(w, "token is missing the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
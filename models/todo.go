@@ -14,5 +14,6 @@ type Todo struct {
     Status      string     `db:"status" json:"status"`
     DueDate     *time.Time `db:"due_date" json:"due_date,omitempty"`
     CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+    UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
     ArchivedAt  *time.Time `db:"archived_at" json:"archived_at,omitempty"`
 }
\ No newline at end of file
@@ -1,6 +1,7 @@
 package models
 
 import (
+    "encoding/json"
     "time"
 
     "github.com/google/uuid"
@@ -11,14 +12,67 @@ type User struct {
     Name         string     `db:"name" json:"name"`
     Email        string     `db:"email" json:"email"`
     Password 	 string     `db:"password" json:"-"`
+    Role         string     `db:"role" json:"role"`
     CreatedAt    time.Time  `db:"created_at" json:"created_at"`
     ArchivedAt   *time.Time `db:"archived_at" json:"archived_at,omitempty"`
+    TokensRevokedAt *time.Time `db:"tokens_revoked_at" json:"-"`
+    EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at,omitempty"`
+    Timezone     string     `db:"timezone" json:"timezone"`
+    Preferences  json.RawMessage `db:"preferences" json:"preferences"`
 }
 
 type UserSession struct {
     ID         	 uuid.UUID  `db:"id" json:"id"`
     UserID     	 uuid.UUID  `db:"user_id" json:"user_id"`
-    SessionToken string     `db:"session_token" json:"session_token"`
+    TokenHash    string     `db:"token_hash" json:"-"`
     CreatedAt  	 time.Time  `db:"created_at" json:"created_at"`
     ExpiresAt  	 time.Time  `db:"expires_at" json:"expires_at"`
-}
\ No newline at end of file
+    LastSeenAt   time.Time  `db:"last_seen_at" json:"last_seen_at"`
+    IPAddress    *string    `db:"ip_address" json:"ip_address,omitempty"`
+    UserAgent    *string    `db:"user_agent" json:"user_agent,omitempty"`
+}
+
+type RefreshToken struct {
+    ID        uuid.UUID  `db:"id" json:"id"`
+    UserID    uuid.UUID  `db:"user_id" json:"user_id"`
+    FamilyID  uuid.UUID  `db:"family_id" json:"family_id"`
+    TokenHash string     `db:"token_hash" json:"-"`
+    CreatedAt time.Time  `db:"created_at" json:"created_at"`
+    ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+    UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+    RevokedAt *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+type AuditEvent struct {
+    ID        uuid.UUID       `db:"id" json:"id"`
+    UserID    *uuid.UUID      `db:"user_id" json:"user_id,omitempty"`
+    Event     string          `db:"event" json:"event"`
+    IPAddress *string         `db:"ip_address" json:"ip_address,omitempty"`
+    UserAgent *string         `db:"user_agent" json:"user_agent,omitempty"`
+    Metadata  json.RawMessage `db:"metadata" json:"metadata"`
+    CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+type MFAChallenge struct {
+    ID        uuid.UUID  `db:"id" json:"id"`
+    UserID    uuid.UUID  `db:"user_id" json:"user_id"`
+    TokenHash string     `db:"token_hash" json:"-"`
+    Method    string     `db:"method" json:"method"`
+    Attempts  int        `db:"attempts" json:"attempts"`
+    CookieMode bool      `db:"cookie_mode" json:"cookie_mode"`
+    CreatedAt time.Time  `db:"created_at" json:"created_at"`
+    ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+    UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+}
+
+type PersonalAccessToken struct {
+    ID         uuid.UUID  `db:"id" json:"id"`
+    UserID     uuid.UUID  `db:"user_id" json:"user_id"`
+    Name       string     `db:"name" json:"name"`
+    TokenHash  string     `db:"token_hash" json:"-"`
+    Scopes     []string   `db:"scopes" json:"scopes"`
+    CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+    ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+    LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+    RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
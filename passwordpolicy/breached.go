@@ -0,0 +1,104 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const hashPrefixLength = 5
+
+// BreachedList answers whether a password is known from a data breach. Both
+// implementations use the Pwned Passwords k-anonymity layout: uppercase SHA-1
+// hashes split into a 5 character prefix and the remaining suffix.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// OpenBreachedList loads path, which is either a directory of range files
+// named by prefix (e.g. 5BAA6, each holding SUFFIX:COUNT lines) that is read
+// on demand, or a single file of full HASH or HASH:COUNT lines kept in memory.
+func OpenBreachedList(path string) (BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return rangeDirectory(path), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return loadHashFile(f)
+}
+
+func sha1Hex(password string) string {
+	h := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+type rangeDirectory string
+
+func (d rangeDirectory) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+
+	f, err := os.Open(filepath.Join(string(d), prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(string(d), prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// hashSet groups suffixes by prefix, mirroring the range files.
+type hashSet map[string]map[string]struct{}
+
+func loadHashFile(r io.Reader) (hashSet, error) {
+	set := hashSet{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" || strings.HasPrefix(hash, "#") {
+			continue
+		}
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d is not a SHA-1 hash", lineNo)
+		}
+		hash = strings.ToUpper(hash)
+		prefix := hash[:hashPrefixLength]
+		if set[prefix] == nil {
+			set[prefix] = map[string]struct{}{}
+		}
+		set[prefix][hash[hashPrefixLength:]] = struct{}{}
+	}
+	return set, scanner.Err()
+}
+
+func (s hashSet) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	_, ok := s[hash[:hashPrefixLength]][hash[hashPrefixLength:]]
+	return ok, nil
+}
@@ -0,0 +1,148 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ray-remotestate/todoEx/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeTooWeak          = "too_weak"
+	CodeContainsPersonal = "contains_personal_info"
+	CodeBreached         = "breached"
+)
+
+// FieldError explains one way in which a value broke the policy.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Policy struct {
+	MinLength      int
+	MaxLength      int
+	MinEntropyBits float64
+	// Breached is optional; without it the breached-password check is skipped.
+	Breached BreachedList
+}
+
+// Default is the policy handlers check against; Init applies the PASSWORD_*
+// settings and loads the breached-password list.
+var Default = &Policy{MinLength: 8, MaxLength: 128, MinEntropyBits: 35}
+
+func Init() {
+	Default = &Policy{
+		MinLength:      config.PasswordMinLength,
+		MaxLength:      config.PasswordMaxLength,
+		MinEntropyBits: float64(config.PasswordMinEntropyBits),
+	}
+	if config.PasswordBreachedListPath != "" {
+		list, err := OpenBreachedList(config.PasswordBreachedListPath)
+		if err != nil {
+			logrus.Fatalf("failed to load breached password list: %v", err)
+		}
+		Default.Breached = list
+	}
+}
+
+// Check validates password, reported under field, and returns every rule it
+// breaks. personal holds the user's email, name and similar values the
+// password must not contain.
+func (p *Policy) Check(field, password string, personal ...string) []FieldError {
+	var errs []FieldError
+	fail := func(code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		fail(CodeTooShort, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		fail(CodeTooLong, "password must be at most %d characters", p.MaxLength)
+	}
+	if length >= p.MinLength && EstimateEntropy(password) < p.MinEntropyBits {
+		fail(CodeTooWeak, "password is too easy to guess; use a longer mix of words, numbers or symbols")
+	}
+	if containsPersonal(password, personal) {
+		fail(CodeContainsPersonal, "password must not contain your name or email address")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			logrus.WithError(err).Warn("breached password lookup failed")
+		} else if breached {
+			fail(CodeBreached, "password has appeared in a data breach; choose a different one")
+		}
+	}
+	return errs
+}
+
+// EstimateEntropy approximates the bits of a brute-force search over the
+// character classes used. Repeated characters and runs such as "abc" or
+// "321" add nothing.
+func EstimateEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effective := 0
+	var prev rune
+	for i, r := range []rune(password) {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || (r != prev && r != prev+1 && r != prev-1) {
+			effective++
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+// containsPersonal looks for the email, its local part and each word of the
+// name, ignoring case. Fragments shorter than three characters are skipped.
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		fragments := strings.Fields(value)
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			fragments = append(fragments, value[:at])
+		}
+		for _, fragment := range fragments {
+			if utf8.RuneCountInString(fragment) >= 3 && strings.Contains(password, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
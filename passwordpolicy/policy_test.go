@@ -0,0 +1,107 @@
+package passwordpolicy
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// SHA-1 of "password", split the way the range files are.
+const (
+	passwordPrefix = "5BAA6"
+	passwordSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+func codes(errs []FieldError) []string {
+	var out []string
+	for _, err := range errs {
+		out = append(out, err.Code)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	policy := &Policy{MinLength: 8, MaxLength: 64, MinEntropyBits: 35, Breached: hashSet{
+		passwordPrefix: {passwordSuffix: {}},
+	}}
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		want     []string
+	}{
+		{"strong", "correct horse battery staple", nil, nil},
+		{"mixed classes", "Tr0ub4dor&3", nil, nil},
+		{"too short", "aB3$", nil, []string{CodeTooShort}},
+		{"too long", strings.Repeat("Tr0ub4dor&3", 6), nil, []string{CodeTooLong}},
+		{"repeated character", "aaaaaaaaaaaa", nil, []string{CodeTooWeak}},
+		{"sequential run", "abcdefghijkl", nil, []string{CodeTooWeak}},
+		{"breached", "password", nil, []string{CodeTooWeak, CodeBreached}},
+		{"contains name", "Xq9!janedoe#7", []string{"Jane Doe", "jd@example.com"}, []string{CodeContainsPersonal}},
+		{"contains email local part", "Xq9!jdoe2026#", []string{"J D", "jdoe@example.com"}, []string{CodeContainsPersonal}},
+		{"short name fragments ignored", "Xq9!jd#7zz", []string{"J D"}, nil},
+	}
+	for _, tt := range tests {
+		got := codes(policy.Check("password", tt.password, tt.personal...))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: codes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"aaaa", math.Log2(26)},
+		{"1234", math.Log2(10)},
+		{"1357", 4 * math.Log2(10)},
+		{"aA1!", 4 * math.Log2(26+26+10+33)},
+	}
+	for _, tt := range tests {
+		if got := EstimateEntropy(tt.password); got != tt.want {
+			t.Errorf("EstimateEntropy(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestOpenBreachedList(t *testing.T) {
+	dir := t.TempDir()
+	rangeFile := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" + passwordSuffix + ":9659365\n"
+	if err := os.WriteFile(filepath.Join(dir, passwordPrefix), []byte(rangeFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hashFile := filepath.Join(t.TempDir(), "hashes.txt")
+	contents := "# comment\n\n" + passwordPrefix + passwordSuffix + ":9659365\n"
+	if err := os.WriteFile(hashFile, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, hashFile} {
+		list, err := OpenBreachedList(path)
+		if err != nil {
+			t.Fatalf("OpenBreachedList(%s): %v", path, err)
+		}
+		for password, want := range map[string]bool{"password": true, "correct horse battery staple": false} {
+			got, err := list.Contains(password)
+			if err != nil || got != want {
+				t.Errorf("%s: Contains(%q) = %v, %v, want %v", path, password, got, err, want)
+			}
+		}
+	}
+
+	badFile := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(badFile, []byte("not-a-hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBreachedList(badFile); err == nil {
+		t.Error("OpenBreachedList accepted a file that is not SHA-1 hashes")
+	}
+}
@@ -2,11 +2,13 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"io"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ray-remotestate/todoEx/config"
 	"github.com/ray-remotestate/todoEx/handlers"
 	"github.com/ray-remotestate/todoEx/middlewares"
 )
@@ -24,26 +26,99 @@ const (
 
 func SetupRoutes() *Server {
 	router := mux.NewRouter()
+	publicRoutes := router.NewRoute().Subrouter()
 	authRoutes := router.PathPrefix("/api").Subrouter()
-	authRoutes.Use(middlewares.AuthMiddleware)
+
+	if config.RateLimitEnabled {
+		store := middlewares.NewRateLimitStore(config.RateLimitBackend)
+		publicRoutes.Use(middlewares.RateLimitMiddleware(store, "public", middlewares.RateLimit{
+			PerMinute: config.RateLimitPublicPerMinute,
+			Burst:     config.RateLimitPublicBurst,
+		}))
+		apiLimit := middlewares.RateLimit{
+			PerMinute: config.RateLimitAPIPerMinute,
+			Burst:     config.RateLimitAPIBurst,
+		}
+		// the first limiter runs before authentication, so requests with bad
+		// credentials are throttled by IP; the second one per user
+		authRoutes.Use(middlewares.RateLimitMiddleware(store, "api-ip", apiLimit))
+		authRoutes.Use(middlewares.AuthMiddleware)
+		authRoutes.Use(middlewares.RateLimitMiddleware(store, "api", apiLimit))
+	} else {
+		authRoutes.Use(middlewares.AuthMiddleware)
+	}
+
+	// every /api route declares the scope a personal access token needs for it
+	scoped := func(scope string, handler http.HandlerFunc) http.Handler {
+		return middlewares.RequireScope(scope)(handler)
+	}
 
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		io.WriteString(w, `{"alive": true}`)
 	}).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
 
 	// user
-	router.HandleFunc("/register_session", handlers.Register_Session).Methods("POST")
-	router.HandleFunc("/register_JWT", handlers.Register_JWT).Methods("POST")
-	router.HandleFunc("/login", handlers.Login).Methods("POST")
-	authRoutes.HandleFunc("/logout", handlers.Logout).Methods("POST")
+	publicRoutes.HandleFunc("/register_session", handlers.Register_Session).Methods("POST")
+	publicRoutes.HandleFunc("/register_JWT", handlers.Register_JWT).Methods("POST")
+	publicRoutes.HandleFunc("/login", handlers.Login).Methods("POST")
+	publicRoutes.HandleFunc("/login_JWT", handlers.Login_JWT).Methods("POST")
+	publicRoutes.HandleFunc("/login/mfa", handlers.CompleteMFALogin).Methods("POST")
+	publicRoutes.HandleFunc("/oidc/login", handlers.OIDCLogin).Methods("GET")
+	publicRoutes.HandleFunc("/oidc/callback", handlers.OIDCCallback).Methods("GET")
+	publicRoutes.HandleFunc("/token/refresh", handlers.RefreshToken).Methods("POST")
+	publicRoutes.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	publicRoutes.HandleFunc("/password/reset", handlers.PasswordResetForm).Methods("GET")
+	publicRoutes.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
+	publicRoutes.HandleFunc("/verify-email", handlers.VerifyEmailForm).Methods("GET")
+	publicRoutes.HandleFunc("/verify-email", handlers.VerifyEmail).Methods("POST")
+	authRoutes.Handle("/logout", scoped(middlewares.ScopeAccountAdmin, handlers.Logout)).Methods("POST")
+	authRoutes.Handle("/verify-email/resend", scoped(middlewares.ScopeAccountAdmin, handlers.ResendEmailVerification)).Methods("POST")
+
+	// account
+	publicRoutes.HandleFunc("/account/restore", handlers.RestoreAccount).Methods("POST")
+	authRoutes.Handle("/me", scoped(middlewares.ScopeAccountAdmin, handlers.GetProfile)).Methods("GET")
+	authRoutes.Handle("/me", scoped(middlewares.ScopeAccountAdmin, handlers.UpdateProfile)).Methods("PATCH")
+	authRoutes.Handle("/me", scoped(middlewares.ScopeAccountAdmin, handlers.DeleteAccount)).Methods("DELETE")
+	authRoutes.Handle("/me/export", scoped(middlewares.ScopeAccountAdmin, handlers.ExportData)).Methods("GET")
+	authRoutes.Handle("/me/password", scoped(middlewares.ScopeAccountAdmin, handlers.ChangePassword)).Methods("POST")
+	authRoutes.Handle("/me/email", scoped(middlewares.ScopeAccountAdmin, handlers.ChangeEmail)).Methods("POST")
+
+	// two-factor authentication
+	authRoutes.Handle("/mfa/totp/enroll", scoped(middlewares.ScopeAccountAdmin, handlers.EnrollTOTP)).Methods("POST")
+	authRoutes.Handle("/mfa/totp/confirm", scoped(middlewares.ScopeAccountAdmin, handlers.ConfirmTOTP)).Methods("POST")
+	authRoutes.Handle("/mfa/totp", scoped(middlewares.ScopeAccountAdmin, handlers.DisableTOTP)).Methods("DELETE")
+
+	// personal access tokens
+	authRoutes.Handle("/tokens", scoped(middlewares.ScopeAccountAdmin, handlers.ListAccessTokens)).Methods("GET")
+	authRoutes.Handle("/tokens", scoped(middlewares.ScopeAccountAdmin, handlers.CreateAccessToken)).Methods("POST")
+	authRoutes.Handle("/tokens/{id}", scoped(middlewares.ScopeAccountAdmin, handlers.RevokeAccessToken)).Methods("DELETE")
+
+	// sessions
+	authRoutes.Handle("/sessions", scoped(middlewares.ScopeAccountAdmin, handlers.ListSessions)).Methods("GET")
+	authRoutes.Handle("/sessions/revoke-others", scoped(middlewares.ScopeAccountAdmin, handlers.RevokeOtherSessions)).Methods("POST")
+	authRoutes.Handle("/sessions/{id}", scoped(middlewares.ScopeAccountAdmin, handlers.RevokeSession)).Methods("DELETE")
 
 	// todo
-	authRoutes.HandleFunc("/todos", handlers.Fetch).Methods("GET")
-	authRoutes.HandleFunc("/todos", handlers.Create).Methods("POST")
-	authRoutes.HandleFunc("/todos/{id}", handlers.Update).Methods("PATCH")
-	authRoutes.HandleFunc("/todos/{id}", handlers.Archive).Methods("DELETE")
+	authRoutes.Handle("/todos", scoped(middlewares.ScopeTodosRead, handlers.Fetch)).Methods("GET")
+	authRoutes.Handle("/todos", scoped(middlewares.ScopeTodosWrite, handlers.Create)).Methods("POST")
+	authRoutes.Handle("/todos/search", scoped(middlewares.ScopeTodosRead, handlers.Search)).Methods("GET")
+	authRoutes.Handle("/todos/{id}", scoped(middlewares.ScopeTodosRead, handlers.FetchByID)).Methods("GET")
+	authRoutes.Handle("/todos/{id}", scoped(middlewares.ScopeTodosWrite, handlers.Update)).Methods("PATCH")
+	authRoutes.Handle("/todos/{id}", scoped(middlewares.ScopeTodosWrite, handlers.Archive)).Methods("DELETE")
+
+	// admin
+	adminRoutes := authRoutes.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(middlewares.RequireRole(middlewares.RoleAdmin), middlewares.RequireScope(middlewares.ScopeUsersAdmin))
+	adminRoutes.HandleFunc("/users", handlers.AdminListUsers).Methods("GET")
+	adminRoutes.HandleFunc("/users/{id}", handlers.AdminGetUser).Methods("GET")
+	adminRoutes.HandleFunc("/users/{id}/archive", handlers.AdminArchiveUser).Methods("POST")
+	adminRoutes.HandleFunc("/users/{id}/unarchive", handlers.AdminRestoreUser).Methods("POST")
+	adminRoutes.HandleFunc("/users/{id}/logout", handlers.AdminLogoutUser).Methods("POST")
+	adminRoutes.HandleFunc("/users/{id}/erase", handlers.AdminEraseUser).Methods("POST")
+	adminRoutes.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 
 	return &Server{
 		Router: router,
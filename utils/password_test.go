@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ray-remotestate/todoEx/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useArgon2Params swaps in cheap parameters so the tests stay fast.
+func useArgon2Params(t *testing.T, memory, time uint32, parallelism uint8) {
+	t.Helper()
+	oldMemory, oldTime, oldParallelism := config.Argon2Memory, config.Argon2Time, config.Argon2Parallelism
+	config.Argon2Memory, config.Argon2Time, config.Argon2Parallelism = memory, time, parallelism
+	t.Cleanup(func() {
+		config.Argon2Memory, config.Argon2Time, config.Argon2Parallelism = oldMemory, oldTime, oldParallelism
+	})
+}
+
+// argon2idHash builds a PHC string with an explicit salt and key length.
+func argon2idHash(pw string, salt []byte, keyLength uint32) string {
+	key := argon2.IDKey([]byte(pw), salt, 1, 1024, 1, keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	useArgon2Params(t, 1024, 1, 1)
+
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix := "$argon2id$v=19$m=1024,t=1,p=1$"; !strings.HasPrefix(hash, prefix) {
+		t.Fatalf("hash %q does not start with %q", hash, prefix)
+	}
+
+	tests := []struct {
+		pw string
+		ok bool
+	}{
+		{"correct horse battery staple", true},
+		{"correct horse battery stapl", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, needsRehash, err := VerifyPassword(hash, tt.pw)
+		if err != nil {
+			t.Errorf("VerifyPassword(%q): %v", tt.pw, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("VerifyPassword(%q) ok = %v, want %v", tt.pw, ok, tt.ok)
+		}
+		if needsRehash {
+			t.Errorf("VerifyPassword(%q) wants a rehash of a current hash", tt.pw)
+		}
+	}
+
+	other, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	const pw = "hunter22hunter22"
+	salt := make([]byte, argon2SaltLength)
+	current := argon2idHash(pw, salt, argon2KeyLength)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		memory      uint32
+		time        uint32
+		parallelism uint8
+		hash        string
+		want        bool
+	}{
+		{"current parameters", 1024, 1, 1, current, false},
+		{"memory raised", 2048, 1, 1, current, true},
+		{"time raised", 1024, 2, 1, current, true},
+		{"parallelism raised", 1024, 1, 2, current, true},
+		{"short salt", 1024, 1, 1, argon2idHash(pw, salt[:8], argon2KeyLength), true},
+		{"short key", 1024, 1, 1, argon2idHash(pw, salt, 16), true},
+		{"legacy bcrypt", 1024, 1, 1, string(bcryptHash), true},
+	}
+	for _, tt := range tests {
+		useArgon2Params(t, tt.memory, tt.time, tt.parallelism)
+		ok, needsRehash, err := VerifyPassword(tt.hash, pw)
+		if err != nil || !ok {
+			t.Errorf("%s: ok = %v, err = %v", tt.name, ok, err)
+			continue
+		}
+		if needsRehash != tt.want {
+			t.Errorf("%s: needsRehash = %v, want %v", tt.name, needsRehash, tt.want)
+		}
+	}
+}
+
+func TestVerifyPasswordMalformed(t *testing.T) {
+	useArgon2Params(t, 1024, 1, 1)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"plain text", "hunter22hunter22"},
+		{"unknown algorithm", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		{"missing key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"},
+		{"wrong version", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5"},
+		{"bad salt", "$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5"},
+		{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$"},
+	}
+	for _, tt := range tests {
+		ok, _, err := VerifyPassword(tt.hash, "hunter22hunter22")
+		if ok || err != ErrUnknownPasswordHash {
+			t.Errorf("%s: ok = %v, err = %v, want ErrUnknownPasswordHash", tt.name, ok, err)
+		}
+	}
+}
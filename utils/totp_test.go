@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed "12345678901234567890" from RFC 6238
+// appendix B, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight-digit codes; a six-digit code is the last six.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(%q) at %d: rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%q) at %d: step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// "050471" belongs to step 37037037, which spans 1111111110-1111111139.
+	const code = "050471"
+	tests := []struct {
+		name string
+		unix int64
+		ok   bool
+	}{
+		{"same step", 1111111111, true},
+		{"one step late", 1111111111 + totpPeriod, true},
+		{"one step early", 1111111111 - totpPeriod, true},
+		{"two steps late", 1111111111 + 2*totpPeriod, false},
+		{"two steps early", 1111111111 - 2*totpPeriod, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(tt.unix, 0))
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && step != 37037037 {
+			t.Errorf("%s: step = %d, want 37037037", tt.name, step)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"lower-case secret", strings.ToLower(rfc6238Secret), "050471", true},
+		{"spaced code", rfc6238Secret, "050 471", true},
+		{"wrong code", rfc6238Secret, "050472", false},
+		{"eight digits", rfc6238Secret, "14050471", false},
+		{"short code", rfc6238Secret, "05047", false},
+		{"empty code", rfc6238Secret, "", false},
+		{"invalid secret", "not base32!", "050471", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q does not decode: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Fatalf("secret decodes to %d bytes, want 20", len(key))
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("ValidateTOTP rejected the current code for a generated secret")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abcd-efgh", "abcd-efgh"},
+		{"ABCDEFGH", "abcd-efgh"},
+		{" abcd efgh ", "abcd-efgh"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
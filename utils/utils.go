@@ -1,45 +1,128 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/ray-remotestate/todoEx/config"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ray-remotestate/todoEx/jwtkeys"
 )
 
-func HashPassword(pw string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
-	return string(bytes), err
-}
-
 func HashString(s string) string {
 	h := sha512.Sum512([]byte(s))
 	return hex.EncodeToString(h[:])
 }
 
+// ClientIP returns the address of the caller, honouring X-Forwarded-For only
+// when the server is configured to sit behind trusted proxies. Each proxy
+// appends the address it saw, so the entry TRUSTED_PROXY_HOPS from the right
+// is the first one a client cannot forge.
+func ClientIP(r *http.Request) string {
+	if config.TrustProxyHeaders {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+		if len(hops) > 0 {
+			i := len(hops) - config.TrustedProxyHops
+			if i < 0 {
+				i = 0
+			}
+			if ip := strings.TrimSpace(hops[i]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IsValidEmail accepts a bare address such as "jane@example.com"; display
+// names, comments and domains without a dot are rejected.
+func IsValidEmail(email string) bool {
+	if len(email) > 254 {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	return at > 0 && strings.Contains(email[at+1:], ".")
+}
+
+// GenerateToken returns a random, URL-safe opaque token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is the digest opaque tokens are stored and looked up by.
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
 func CreateJWTToken(uID uuid.UUID) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
-		"userID": uID,
-		"expiry": time.Now().Add(time.Hour * 24).Unix(),
+	now := time.Now()
+	key := jwtkeys.Signing()
+	token := jwt.NewWithClaims(key.Method, jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   uID.String(),
+		Issuer:    config.JWTIssuer,
+		Audience:  jwt.ClaimStrings{config.JWTAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(config.JWTLifetime)),
 	})
+	token.Header["kid"] = key.ID
 
-	return token.SignedString(config.SecretKey)
+	return token.SignedString(key.SigningKey())
 }
 
-func VerifyJWTToken(tokenString string) error {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return config.SecretKey, nil
-	})
+// VerifyJWTToken checks the signature, expiry, issuer and audience of the token
+// and returns its claims. The key is picked by kid and must match the alg the
+// token claims, so a public key can never be used as an HMAC secret.
+func VerifyJWTToken(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := jwtkeys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("token alg %s does not match key %q", token.Method.Alg(), kid)
+		}
+		return key.VerificationKey(), nil
+	},
+		jwt.WithValidMethods(jwtkeys.Methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(config.JWTIssuer),
+		jwt.WithAudience(config.JWTAudience),
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !token.Valid {
-		return fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
-	return nil
+	return claims, nil
 }
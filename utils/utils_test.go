@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ray-remotestate/todoEx/config"
+)
+
+func TestClientIP(t *testing.T) {
+	oldTrust, oldHops := config.TrustProxyHeaders, config.TrustedProxyHops
+	defer func() { config.TrustProxyHeaders, config.TrustedProxyHops = oldTrust, oldHops }()
+
+	tests := []struct {
+		name       string
+		trust      bool
+		hops       int
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"proxy headers ignored", false, 1, "10.0.0.1:4000", []string{"203.0.113.7"}, "10.0.0.1"},
+		{"no header", true, 1, "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"one hop", true, 1, "10.0.0.1:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"one hop ignores spoofed entries", true, 1, "10.0.0.1:4000", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"two hops", true, 2, "10.0.0.1:4000", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"two hops across headers", true, 2, "10.0.0.1:4000", []string{"1.2.3.4, 203.0.113.7", "10.0.0.2"}, "203.0.113.7"},
+		{"more hops than entries", true, 3, "10.0.0.1:4000", []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"empty entry", true, 1, "10.0.0.1:4000", []string{"203.0.113.7, "}, "10.0.0.1"},
+		{"remote address without port", false, 1, "10.0.0.1", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		config.TrustProxyHeaders, config.TrustedProxyHops = tt.trust, tt.hops
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.xff {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}